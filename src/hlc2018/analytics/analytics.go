@@ -0,0 +1,165 @@
+package analytics
+
+import (
+	"hlc2018/store"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	pageRankDamping     = 0.85
+	pageRankIterations  = 50
+	communityIterations = 20
+)
+
+// Result is the analytics of the likes graph at ComputedAt. it is not modified after it is published.
+type Result struct {
+	ComputedAt time.Time
+	Elapsed    time.Duration
+	// 0 for ids without accounts
+	PageRank    []float64
+	Reciprocity []float64
+	// the smallest id in the weakly connected component of each account, or -1 for ids without accounts
+	Component     []int
+	ComponentSize map[int]int
+	// -1 for ids without accounts
+	Community     []int
+	CommunitySize map[int]int
+}
+
+// GraphAnalytics computes Result from LikeStore in the background. only one computation runs at a time and
+// requests keep reading the previous Result until the next one is published.
+type GraphAnalytics struct {
+	likeStore *store.LikeStore
+
+	mu      sync.RWMutex
+	result  *Result
+	running bool
+}
+
+func NewGraphAnalytics(likeStore *store.LikeStore) *GraphAnalytics {
+	return &GraphAnalytics{likeStore: likeStore}
+}
+
+func sizes(labels []int) map[int]int {
+	ret := map[int]int{}
+	for _, l := range labels {
+		if l != noLabel {
+			ret[l]++
+		}
+	}
+	return ret
+}
+
+func compute(graph [][]int, exists []bool) *Result {
+	before := time.Now()
+	r := &Result{
+		PageRank:    pageRank(graph, exists, pageRankDamping, pageRankIterations),
+		Reciprocity: reciprocity(graph),
+		Component:   components(graph, exists),
+		Community:   communities(graph, exists, communityIterations),
+	}
+	r.ComponentSize = sizes(r.Component)
+	r.CommunitySize = sizes(r.Community)
+	r.ComputedAt = time.Now()
+	r.Elapsed = r.ComputedAt.Sub(before)
+	return r
+}
+
+// Run starts a computation in the background and returns false if one is already running.
+// the graph is copied at the start of the computation, so likes inserted later are reflected in the next run.
+func (ga *GraphAnalytics) Run() bool {
+	ga.mu.Lock()
+	if ga.running {
+		ga.mu.Unlock()
+		return false
+	}
+	ga.running = true
+	ga.mu.Unlock()
+
+	go func() {
+		graph, exists := ga.likeStore.LikeGraph()
+		r := compute(graph, exists)
+		log.Printf("graph analytics computed in %v (%d accounts)", r.Elapsed, len(graph))
+
+		ga.mu.Lock()
+		defer ga.mu.Unlock()
+		ga.result = r
+		ga.running = false
+	}()
+	return true
+}
+
+// Schedule runs the computation every interval.
+func (ga *GraphAnalytics) Schedule(interval time.Duration) {
+	ga.Run()
+	go func() {
+		for range time.Tick(interval) {
+			ga.Run()
+		}
+	}()
+}
+
+// Result returns the latest result or nil before the first one is computed.
+func (ga *GraphAnalytics) Result() *Result {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+	return ga.result
+}
+
+func (ga *GraphAnalytics) Running() bool {
+	ga.mu.RLock()
+	defer ga.mu.RUnlock()
+	return ga.running
+}
+
+// PageRank returns the PageRank of id in the latest result, or 1 (the average) without it.
+func (ga *GraphAnalytics) PageRank(id int) float64 {
+	r := ga.Result()
+	if r == nil || id >= len(r.PageRank) {
+		return 1
+	}
+	return r.PageRank[id]
+}
+
+// TopPageRank returns up to limit ids in descending order of PageRank.
+func (r *Result) TopPageRank(limit int) []int {
+	var ids []int
+	for id, rank := range r.PageRank {
+		if rank > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		x, y := r.PageRank[ids[i]], r.PageRank[ids[j]]
+		if x != y {
+			return x > y
+		}
+		return ids[i] > ids[j]
+	})
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
+
+// LargestGroups returns up to limit labels in descending order of their sizes.
+func LargestGroups(sizes map[int]int, limit int) []int {
+	var labels []int
+	for l, _ := range sizes {
+		labels = append(labels, l)
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		x, y := sizes[labels[i]], sizes[labels[j]]
+		if x != y {
+			return x > y
+		}
+		return labels[i] < labels[j]
+	})
+	if len(labels) > limit {
+		labels = labels[:limit]
+	}
+	return labels
+}
@@ -0,0 +1,163 @@
+package analytics
+
+import "math"
+
+// the label of ids without accounts in components and communities
+const noLabel = -1
+
+// pageRank computes PageRank over graph by power iteration. likes from accounts without likees are spread to
+// every account. values are scaled so that their average is 1, and ids without accounts have 0.
+func pageRank(graph [][]int, exists []bool, damping float64, iterations int) []float64 {
+	n := 0
+	rank := make([]float64, len(graph))
+	for i := range rank {
+		if exists[i] {
+			rank[i] = 1
+			n++
+		}
+	}
+	if n == 0 {
+		return rank
+	}
+	next := make([]float64, len(graph))
+	for it := 0; it < iterations; it++ {
+		dangling := 0.0
+		for i := range next {
+			next[i] = 0
+		}
+		for from, tos := range graph {
+			if !exists[from] {
+				continue
+			}
+			if len(tos) == 0 {
+				dangling += rank[from]
+				continue
+			}
+			share := rank[from] / float64(len(tos))
+			for _, to := range tos {
+				next[to] += share
+			}
+		}
+		diff := 0.0
+		base := (1 - damping) + damping*dangling/float64(n)
+		for i := range next {
+			if !exists[i] {
+				continue
+			}
+			next[i] = base + damping*next[i]
+			diff += math.Abs(next[i] - rank[i])
+		}
+		rank, next = next, rank
+		if diff/float64(n) < 1e-9 {
+			break
+		}
+	}
+	return rank
+}
+
+// reciprocity returns the share of the likees of each account which like it back, or 0 without likees.
+func reciprocity(graph [][]int) []float64 {
+	liked := make([]map[int]struct{}, len(graph))
+	for from, tos := range graph {
+		liked[from] = make(map[int]struct{}, len(tos))
+		for _, to := range tos {
+			liked[from][to] = struct{}{}
+		}
+	}
+	ret := make([]float64, len(graph))
+	for from, tos := range graph {
+		if len(tos) == 0 {
+			continue
+		}
+		mutual := 0
+		for _, to := range tos {
+			if _, found := liked[to][from]; found {
+				mutual++
+			}
+		}
+		ret[from] = float64(mutual) / float64(len(tos))
+	}
+	return ret
+}
+
+func find(parent []int, x int) int {
+	for parent[x] != x {
+		parent[x] = parent[parent[x]]
+		x = parent[x]
+	}
+	return x
+}
+
+// components labels the weakly connected components by their smallest id.
+func components(graph [][]int, exists []bool) []int {
+	parent := make([]int, len(graph))
+	for i := range parent {
+		parent[i] = i
+	}
+	for from, tos := range graph {
+		for _, to := range tos {
+			x, y := find(parent, from), find(parent, to)
+			if x < y {
+				parent[y] = x
+			} else if y < x {
+				parent[x] = y
+			}
+		}
+	}
+	for i := range parent {
+		parent[i] = find(parent, i)
+	}
+	for i := range parent {
+		if !exists[i] {
+			parent[i] = noLabel
+		}
+	}
+	return parent
+}
+
+// communities runs label propagation over the undirected likes. every account starts with its own id
+// and takes the most frequent label of its neighbours, the smallest one on ties.
+func communities(graph [][]int, exists []bool, iterations int) []int {
+	neighbours := make([][]int, len(graph))
+	for from, tos := range graph {
+		for _, to := range tos {
+			neighbours[from] = append(neighbours[from], to)
+			neighbours[to] = append(neighbours[to], from)
+		}
+	}
+	label := make([]int, len(graph))
+	for i := range label {
+		label[i] = i
+	}
+	for it := 0; it < iterations; it++ {
+		changed := false
+		for id, ns := range neighbours {
+			if len(ns) == 0 {
+				continue
+			}
+			counts := map[int]int{}
+			for _, n := range ns {
+				counts[label[n]]++
+			}
+			best, bestCount := label[id], 0
+			for l, c := range counts {
+				if c > bestCount || (c == bestCount && l < best) {
+					best, bestCount = l, c
+				}
+			}
+			if best != label[id] {
+				label[id] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	for i := range label {
+		if !exists[i] {
+			label[i] = noLabel
+		}
+	}
+	return label
+}
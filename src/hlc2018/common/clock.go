@@ -0,0 +1,53 @@
+package common
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Clock tells the current time of the server in unix seconds.
+type Clock interface {
+	Now() int
+}
+
+// fixedClock is the time in options.txt as HLC requires.
+type fixedClock struct{}
+
+func (fixedClock) Now() int {
+	return PREMIUM_NOW_UNIX
+}
+
+type realClock struct{}
+
+func (realClock) Now() int {
+	return int(time.Now().Unix())
+}
+
+// ServerClock is fixed by default and can be changed to the real time by CLOCK=real.
+var ServerClock = clockFromEnv()
+
+func clockFromEnv() Clock {
+	switch os.Getenv("CLOCK") {
+	case "", "fixed":
+		return fixedClock{}
+	case "real":
+		return realClock{}
+	}
+	log.Fatalf("clock (%s) not found", os.Getenv("CLOCK"))
+	return nil
+}
+
+// IsFixedClock returns true if the server clock never moves.
+func IsFixedClock() bool {
+	_, fixed := ServerClock.(fixedClock)
+	return fixed
+}
+
+func Now() int {
+	return ServerClock.Now()
+}
+
+func IsPremiumNow(start, end, now int) bool {
+	return start <= now && now <= end
+}
@@ -31,10 +31,20 @@ type RawAccount struct {
 		Ts int `json:"ts"`
 		ID int `json:"id"`
 	} `json:"likes,omitempty"`
-	Birth   int    `json:"birth,omitempty"`
-	City    string `json:"city,omitempty"`
-	Country string `json:"country,omitempty"`
-	Joined  int    `json:"joined,omitempty"`
+	Birth       int             `json:"birth,omitempty"`
+	City        string          `json:"city,omitempty"`
+	Country     string          `json:"country,omitempty"`
+	Joined      int             `json:"joined,omitempty"`
+	Preferences *RawPreferences `json:"preferences,omitempty"`
+}
+
+// RawPreferences are the optional conditions on partners used by recommend.
+type RawPreferences struct {
+	Sex     []string `json:"sex,omitempty"`
+	AgeFrom int      `json:"age_from,omitempty"`
+	AgeTo   int      `json:"age_to,omitempty"`
+	City    string   `json:"city,omitempty"`
+	Country string   `json:"country,omitempty"`
 }
 
 type RawAccountsContainer struct {
@@ -76,6 +86,61 @@ type Account struct {
 	City          string     `db:"city"`
 	Country       string     `db:"country"`
 	JoinedYear    JoinedYear `db:"joined_year"`
+	// nil when preferences are not given
+	Preferences *Preferences `db:"-"`
+}
+
+// Preferences are the conditions on partners. zero values mean no condition.
+type Preferences struct {
+	// bit (sex - 1) is set for each sought sex
+	Sexes   int8
+	AgeFrom int
+	AgeTo   int
+	City    string
+	Country string
+}
+
+func (p *Preferences) SeeksSex(sex int8) bool {
+	if p.Sexes == 0 {
+		return true
+	}
+	return sex != 0 && p.Sexes&(1<<uint(sex-1)) != 0
+}
+
+func (p *Preferences) IsEmpty() bool {
+	return *p == Preferences{}
+}
+
+func (rp *RawPreferences) ToPreferences() (*Preferences, error) {
+	var p Preferences
+	for _, s := range rp.Sex {
+		sex := SexFromString(s)
+		if sex == 0 {
+			return nil, fmt.Errorf("%s is not valid sex", s)
+		}
+		p.Sexes |= 1 << uint(sex-1)
+	}
+	if rp.AgeFrom < 0 || rp.AgeTo < 0 {
+		return nil, fmt.Errorf("age should not be negative (%d - %d)", rp.AgeFrom, rp.AgeTo)
+	}
+	if rp.AgeTo != 0 && rp.AgeFrom > rp.AgeTo {
+		return nil, fmt.Errorf("age range is empty (%d - %d)", rp.AgeFrom, rp.AgeTo)
+	}
+	p.AgeFrom = rp.AgeFrom
+	p.AgeTo = rp.AgeTo
+	p.City = rp.City
+	p.Country = rp.Country
+	return &p, nil
+}
+
+func (p *Preferences) ToRawPreferences() *RawPreferences {
+	r := RawPreferences{AgeFrom: p.AgeFrom, AgeTo: p.AgeTo, City: p.City, Country: p.Country}
+	for i, s := range SEXES {
+		if p.Sexes&(1<<uint(i)) != 0 {
+			r.Sex = append(r.Sex, s)
+		}
+	}
+	return &r
 }
 
 type AccountContainer struct {
@@ -114,6 +179,19 @@ func SexFromString(s string) int8 {
 	return int8(SliceIndex(SEXES, s) + 1)
 }
 
+// StatusRecommendOrder returns the rank of status in recommend. smaller is better.
+// "свободны" comes first, then "всё сложно" and "заняты".
+func StatusRecommendOrder(status int8) int {
+	switch status {
+	case 3:
+		return 0
+	case 1:
+		return 1
+	default:
+		return 2
+	}
+}
+
 var PREMIUM_NOW_UNIX int
 
 func init() {
@@ -132,11 +210,11 @@ func (rawAccount *RawAccount) ToAccount() (*Account, error) {
 	a.ID = rawAccount.ID
 	a.Fname = rawAccount.Fname
 	a.Sname = rawAccount.Sname
-	a.Email = rawAccount.Email
 	if rawAccount.Email != "" {
 		if strings.Count(rawAccount.Email, "@") != 1 {
 			return nil, fmt.Errorf("email doesn't have `@`: %s", rawAccount.Email)
 		}
+		a.Email = NormalizeEmail(rawAccount.Email)
 	}
 	a.Status = StatusFromString(rawAccount.Status)
 	if a.Status == 0 && rawAccount.Status != "" {
@@ -145,7 +223,7 @@ func (rawAccount *RawAccount) ToAccount() (*Account, error) {
 	if rawAccount.Premium != nil {
 		a.Premium_start = rawAccount.Premium.Start
 		a.Premium_end = rawAccount.Premium.Finish
-		a.Premium_now = a.Premium_start <= PREMIUM_NOW_UNIX && PREMIUM_NOW_UNIX <= a.Premium_end
+		a.Premium_now = IsPremiumNow(a.Premium_start, a.Premium_end, Now())
 	}
 	a.Sex = SexFromString(rawAccount.Sex)
 	if a.Sex == 0 && rawAccount.Sex != "" {
@@ -156,6 +234,13 @@ func (rawAccount *RawAccount) ToAccount() (*Account, error) {
 	a.City = rawAccount.City
 	a.Country = rawAccount.Country
 	a.JoinedYear = ToJoinedYear(time.Unix(int64(rawAccount.Joined), 0).Year())
+	if rawAccount.Preferences != nil {
+		p, err := rawAccount.Preferences.ToPreferences()
+		if err != nil {
+			return nil, err
+		}
+		a.Preferences = p
+	}
 
 	return &a, nil
 }
@@ -250,6 +335,9 @@ func (a *Account) ToRawAccount() *RawAccount {
 	r.City = a.City
 	r.Country = a.Country
 	r.Joined = 0 // No end-points refer this
+	if a.Preferences != nil {
+		r.Preferences = a.Preferences.ToRawPreferences()
+	}
 
 	return &r
 }
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	maxEmailLocalLength  = 64
+	maxEmailDomainLength = 253
+	maxEmailLabelLength  = 63
+)
+
+// LowercaseEmailLocal makes the local parts of emails case-insensitive too. it is set by EMAIL_LOWERCASE_LOCAL=1.
+// domains are always lowercased.
+var LowercaseEmailLocal = lowercaseEmailLocalFromEnv()
+
+func lowercaseEmailLocalFromEnv() bool {
+	switch os.Getenv("EMAIL_LOWERCASE_LOCAL") {
+	case "", "0":
+		return false
+	case "1":
+		return true
+	}
+	log.Fatalf("EMAIL_LOWERCASE_LOCAL (%s) should be 0 or 1", os.Getenv("EMAIL_LOWERCASE_LOCAL"))
+	return false
+}
+
+// the special characters allowed in dot-atom of RFC 5322
+const emailAtextSpecials = "!#$%&'*+-/=?^_`{|}~"
+
+func isEmailAtext(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		strings.IndexByte(emailAtextSpecials, c) != -1
+}
+
+func isAlnum(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// validateEmailLocal accepts dot-atom local parts. quoted strings are not supported.
+func validateEmailLocal(local string) error {
+	if local == "" || len(local) > maxEmailLocalLength {
+		return fmt.Errorf("length of local part should be in [1, %d]", maxEmailLocalLength)
+	}
+	for _, atom := range strings.Split(local, ".") {
+		if atom == "" {
+			return fmt.Errorf("local part (%s) has an empty atom", local)
+		}
+		for i := 0; i < len(atom); i++ {
+			if !isEmailAtext(atom[i]) {
+				return fmt.Errorf("local part (%s) has an invalid character %q", local, atom[i])
+			}
+		}
+	}
+	return nil
+}
+
+// validateEmailDomain accepts host names made of letters, digits and hyphens.
+func validateEmailDomain(domain string) error {
+	if domain == "" || len(domain) > maxEmailDomainLength {
+		return fmt.Errorf("length of domain should be in [1, %d]", maxEmailDomainLength)
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > maxEmailLabelLength {
+			return fmt.Errorf("length of labels of domain (%s) should be in [1, %d]", domain, maxEmailLabelLength)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("label of domain (%s) cannot start or end with -", domain)
+		}
+		for i := 0; i < len(label); i++ {
+			if !isAlnum(label[i]) && label[i] != '-' {
+				return fmt.Errorf("domain (%s) has an invalid character %q", domain, label[i])
+			}
+		}
+	}
+	return nil
+}
+
+func normalizeEmailLocal(local string) string {
+	if LowercaseEmailLocal {
+		return strings.ToLower(local)
+	}
+	return local
+}
+
+// ValidateEmail checks the syntax of email. it is applied to inserted and updated accounts,
+// while the loaded data is only normalized.
+func ValidateEmail(email string) error {
+	at := strings.LastIndexByte(email, '@')
+	if at == -1 {
+		return fmt.Errorf("email doesn't have `@`: %s", email)
+	}
+	if err := validateEmailLocal(email[:at]); err != nil {
+		return err
+	}
+	return validateEmailDomain(email[at+1:])
+}
+
+// NormalizeEmail returns the form stored and compared for uniqueness. it also normalizes prefixes of emails
+// like the values of email_lt and email_gt, so that they are compared with the stored emails in the same way.
+func NormalizeEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	if at == -1 {
+		return normalizeEmailLocal(email)
+	}
+	return normalizeEmailLocal(email[:at]) + "@" + strings.ToLower(email[at+1:])
+}
+
+func NormalizeEmailDomain(domain string) string {
+	return strings.ToLower(domain)
+}
@@ -1,11 +1,18 @@
 package globals
 
 import (
+	"hlc2018/analytics"
 	"hlc2018/store"
+	"os"
 )
 
 var (
 	As = store.NewAccountStore()
 	Ls = store.NewLikeStore(As)
 	Is = store.NewInterestStore()
+	Bs = store.NewBlockStore()
+	Ga = analytics.NewGraphAnalytics(Ls)
+	Gz = store.NewGazetteer()
+	Ps = store.NewPremiumScheduler(As)
+	Ri = store.NewRecommendIndex(As, Is, os.Getenv("RECOMMEND_INDEX_BY_COUNTRY") == "1")
 )
@@ -38,7 +38,7 @@ type AccountsFilterParams struct {
 	snameEq           string
 	snameStarts       string
 	snameNull         Tribool
-	phoneCode         int
+	phoneCode         store.PhoneCode
 	phoneNull         Tribool
 	countryEq         string
 	countryNull       Tribool
@@ -73,17 +73,17 @@ func emailDomainFilter(param string, afp *AccountsFilterParams) error {
 	if strings.Contains(param, "%") {
 		return fmt.Errorf("domain (%s) cannot contain \"%%\"", param)
 	}
-	afp.emailDomain = param
+	afp.emailDomain = common.NormalizeEmailDomain(param)
 	return nil
 }
 
 func emailLtFilter(param string, afp *AccountsFilterParams) error {
-	afp.emailLt = param
+	afp.emailLt = common.NormalizeEmail(param)
 	return nil
 }
 
 func emailGtFilter(param string, afp *AccountsFilterParams) error {
-	afp.emailGt = param
+	afp.emailGt = common.NormalizeEmail(param)
 	return nil
 }
 
@@ -121,18 +121,13 @@ func snameStartsFilter(param string, afp *AccountsFilterParams) error {
 }
 
 func phoneCodeFilter(param string, afp *AccountsFilterParams) error {
-	if len(param) != 3 {
-		return fmt.Errorf("phone code param length should be 3 but %s", len(param))
-	}
-	for _, c := range param {
-		if c < '0' || c > '9' {
-			return fmt.Errorf("phone code param should be [0-9] : %s", param)
-		}
+	code, err := store.PhoneCodeFromString(param)
+	if err != nil {
+		return err
 	}
 	afp.addSelect("phone")
-	var err error
-	afp.phoneCode, err = strconv.Atoi(param)
-	return err
+	afp.phoneCode = code
+	return nil
 }
 
 func cityAnyFilter(param string, afp *AccountsFilterParams) error {
@@ -329,7 +324,7 @@ var filterFuncs = map[string]FilterFunc{
 	"sname_eq":           snameEqFilter,   // 1 / 1000
 	"sname_starts":       snameStartsFilter,
 	"sname_null":         snameNullFilter,   // 1/4
-	"phone_code":         phoneCodeFilter,   // 1/200 ~ 1/300 NOTE: only (900) ~ (999) are available
+	"phone_code":         phoneCodeFilter,   // 1/200 ~ 1/300
 	"phone_null":         phoneNullFilter,   // 1/2
 	"country_eq":         countryEqFilter,   // 1/40 ~ 1/100
 	"country_null":       countryNullFilter, // 1/6
@@ -429,6 +424,9 @@ func GenFilterFromAccountsFilterParams(afp *AccountsFilterParams) store.StoreFil
 		}
 
 		me := globals.As.GetStoredAccountWithoutError(id)
+		if me == nil {
+			return false
+		}
 
 		//  "sex_eq":             SexEqFilter, // 1/2
 		if afp.sexEq != 0 {
@@ -516,7 +514,7 @@ func GenFilterFromAccountsFilterParams(afp *AccountsFilterParams) store.StoreFil
 			}
 		}
 
-		if afp.phoneCode != 0 {
+		if !afp.phoneCode.IsEmpty() {
 			if !me.Phone.HasPhoneCode(afp.phoneCode) {
 				return false
 			}
@@ -524,11 +522,11 @@ func GenFilterFromAccountsFilterParams(afp *AccountsFilterParams) store.StoreFil
 
 		if afp.phoneNull != TUndefined {
 			if afp.phoneNull == TTrue {
-				if me.Phone.Int != 0 {
+				if !me.Phone.IsEmpty() {
 					return false
 				}
 			} else {
-				if me.Phone.Int == 0 {
+				if me.Phone.IsEmpty() {
 					return false
 				}
 			}
@@ -616,49 +614,42 @@ func GenFilterFromAccountsFilterParams(afp *AccountsFilterParams) store.StoreFil
 	}
 }
 
-func SplitFilterParamsIntoStoreAndFilter(originalAfp *AccountsFilterParams) (*AccountsFilterParams, store.StoreSource) {
-	afp := *originalAfp
+// indexedIdsFromFilterParams picks the most selective index usable by originalAfp.
+// It returns the ids from that index sorted in descending order and a copy of the params without
+// the condition covered by the index. found is false when no index can be used.
+func indexedIdsFromFilterParams(originalAfp *AccountsFilterParams) (afp *AccountsFilterParams, ids []int, found bool) {
+	copied := *originalAfp
+	afp = &copied
+
+	var mp map[int]struct{}
 	//?
 	if len(afp.likeContains) > 0 {
-		mp := globals.Ls.IdsContainAllLikes(afp.likeContains)
-
-		var ids []int
-		for id, _ := range mp {
-			ids = append(ids, id)
-		}
-		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
-
+		mp = globals.Ls.IdsContainAllLikes(afp.likeContains)
 		afp.likeContains = nil
-		return &afp, store.NewArrayStoreSource(ids)
-	}
-
-	// 1/30 if length == 1
-	if len(afp.interestsContains) > 0 {
-		mp := globals.Is.ContainsAllFromInterests(afp.interestsContains)
-
-		var ids []int
-		for id, _ := range mp {
-			ids = append(ids, id)
-		}
-
-		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
-
+	} else if len(afp.interestsContains) > 0 {
+		// 1/30 if length == 1
+		mp = globals.Is.ContainsAllFromInterests(afp.interestsContains)
 		afp.interestsContains = nil
-		return &afp, store.NewArrayStoreSource(ids)
+	} else if len(afp.interestsAny) > 0 {
+		// 1/30 if length == 1
+		mp = globals.Is.ContainsAnyFromInterests(afp.interestsAny)
+		afp.interestsAny = nil
+	} else {
+		return afp, nil, false
 	}
 
-	// 1/30 if length == 1
-	if len(afp.interestsAny) > 0 {
-		mp := globals.Is.ContainsAnyFromInterests(afp.interestsAny)
-		var ids []int
-		for id, _ := range mp {
-			ids = append(ids, id)
-		}
+	for id, _ := range mp {
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ids)))
 
-		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+	return afp, ids, true
+}
 
-		afp.interestsAny = nil
-		return &afp, store.NewArrayStoreSource(ids)
+func SplitFilterParamsIntoStoreAndFilter(originalAfp *AccountsFilterParams) (*AccountsFilterParams, store.StoreSource) {
+	afp, ids, found := indexedIdsFromFilterParams(originalAfp)
+	if found {
+		return afp, store.NewArrayStoreSource(ids)
 	}
 
 	//
@@ -674,7 +665,7 @@ func SplitFilterParamsIntoStoreAndFilter(originalAfp *AccountsFilterParams) (*Ac
 	//	"sname_eq":           snameEqFilter,   // 1 / 1000
 	//	"sname_starts":       snameStartsFilter,
 	//	"sname_null":         snameNullFilter,   // 1/4
-	//	"phone_code":         phoneCodeFilter,   // 1/200 ~ 1/300 NOTE: only (900) ~ (999) are available
+	//	"phone_code":         phoneCodeFilter,   // 1/200 ~ 1/300
 	//	"phone_null":         phoneNullFilter,   // 1/2
 	//	"country_eq":         countryEqFilter,   // 1/40 ~ 1/100
 	//	"country_null":       countryNullFilter, // 1/6
@@ -688,7 +679,7 @@ func SplitFilterParamsIntoStoreAndFilter(originalAfp *AccountsFilterParams) (*Ac
 	//	"premium_null":       premiumNullFilter, // 2/3
 
 	// default because there're no index
-	return &afp, globals.As.NewRangeAccountStoreSource()
+	return afp, globals.As.NewRangeAccountStoreSource()
 }
 
 func filterIdsFromFilterParam(originalAfp *AccountsFilterParams) []int {
@@ -700,6 +691,45 @@ func filterIdsFromFilterParam(originalAfp *AccountsFilterParams) []int {
 	return ret
 }
 
+// projectStoredAccount copies id, email and the selected fields of a into a new common.Account.
+func projectStoredAccount(a *store.StoredAccount, selects map[string]struct{}) *common.Account {
+	r := common.Account{
+		ID:    a.ID,
+		Email: a.Email,
+	}
+	if _, found := selects["sex"]; found {
+		r.Sex = a.Sex
+	}
+	if _, found := selects["status"]; found {
+		r.Status = a.Status
+	}
+	if _, found := selects["fname"]; found {
+		r.Fname = a.Fname
+	}
+	if _, found := selects["sname"]; found {
+		r.Sname = a.Sname
+	}
+	if _, found := selects["phone"]; found {
+		r.Phone = a.Phone.String()
+	}
+	if _, found := selects["city"]; found {
+		r.City = globals.As.IdToCity(a.City)
+	}
+	if _, found := selects["country"]; found {
+		r.Country = globals.As.IdToCountry(a.Country)
+	}
+	if _, found := selects["birth"]; found {
+		r.Birth = a.Birth
+	}
+	if _, found := selects["premium_start"]; found {
+		r.Premium_start = a.Premium_start
+	}
+	if _, found := selects["premium_end"]; found {
+		r.Premium_end = a.Premium_end
+	}
+	return &r
+}
+
 func AccountsFilterCore(queryParams url.Values) (*common.AccountContainer, *HlcHttpError) {
 	afp, err := accountsFilterParser(queryParams)
 	if err != nil {
@@ -708,47 +738,15 @@ func AccountsFilterCore(queryParams url.Values) (*common.AccountContainer, *HlcH
 	}
 	ansIds := filterIdsFromFilterParam(afp)
 
+	return accountContainerFromIds(ansIds, afp.selects), nil
+}
+
+func accountContainerFromIds(ids []int, selects map[string]struct{}) *common.AccountContainer {
 	afas := common.AccountContainer{}
-	for _, id := range ansIds {
-		a := globals.As.GetStoredAccountWithoutError(id)
-		r := common.Account{
-			ID:    a.ID,
-			Email: a.Email,
-		}
-		if _, found := afp.selects["sex"]; found {
-			r.Sex = a.Sex
-		}
-		if _, found := afp.selects["status"]; found {
-			r.Status = a.Status
-		}
-		if _, found := afp.selects["fname"]; found {
-			r.Fname = a.Fname
-		}
-		if _, found := afp.selects["sname"]; found {
-			r.Sname = a.Sname
-		}
-		if _, found := afp.selects["phone"]; found {
-			r.Phone = a.Phone.String()
-		}
-		if _, found := afp.selects["city"]; found {
-			r.City = globals.As.IdToCity(a.City)
-		}
-		if _, found := afp.selects["country"]; found {
-			r.Country = globals.As.IdToCountry(a.Country)
-		}
-		if _, found := afp.selects["birth"]; found {
-			r.Birth = a.Birth
-		}
-		if _, found := afp.selects["premium_start"]; found {
-			r.Premium_start = a.Premium_start
-		}
-		if _, found := afp.selects["premium_end"]; found {
-			r.Premium_end = a.Premium_end
-		}
-		afas.Accounts = append(afas.Accounts, &r)
+	for _, id := range ids {
+		afas.Accounts = append(afas.Accounts, projectStoredAccount(globals.As.GetStoredAccountWithoutError(id), selects))
 	}
-
-	return &afas, nil
+	return &afas
 }
 
 func AccountsFilterHandler(c echo.Context) error {
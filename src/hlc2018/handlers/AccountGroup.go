@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"container/heap"
 	"fmt"
 	"github.com/labstack/echo"
 	"hlc2018/common"
@@ -17,6 +18,7 @@ import (
 
 type AccountGroupParam struct {
 	keys            map[string]struct{}
+	dims            []int
 	limit           int
 	order           int
 	sexEq           int8
@@ -27,6 +29,13 @@ type AccountGroupParam struct {
 	statusEq        int8
 	interestContain string
 	birthYear       int
+	aggregates      []string
+	// empty means count
+	sortBy string
+	// thresholds applied after grouping. -1 means not specified
+	countGt int
+	countLt int
+	offset  int
 }
 
 type AccountGroupFunc func(param string, agp *AccountGroupParam) error
@@ -60,12 +69,16 @@ func countryGroupParser(param string, agp *AccountGroupParam) error {
 }
 
 func keysGroupParser(param string, agp *AccountGroupParam) error {
-	validKeys := []string{"sex", "status", "interests", "country", "city"}
 	for _, k := range strings.Split(param, ",") {
-		if common.SliceIndex(validKeys, k) == -1 {
+		dim := common.SliceIndex(groupDimNames[:], k)
+		if dim == -1 {
 			return fmt.Errorf("invalid keys (%s)", k)
 		}
+		if _, found := agp.keys[k]; found {
+			continue
+		}
 		agp.keys[k] = struct{}{}
+		agp.dims = append(agp.dims, dim)
 	}
 	return nil
 }
@@ -138,63 +151,253 @@ func cityGroupParser(param string, agp *AccountGroupParam) error {
 	return nil
 }
 
+func aggregatesGroupParser(param string, agp *AccountGroupParam) error {
+	for _, a := range strings.Split(param, ",") {
+		if common.SliceIndex(groupAggregateNames, a) == -1 {
+			return fmt.Errorf("invalid aggregates (%s)", a)
+		}
+		if common.SliceIndex(agp.aggregates, a) == -1 {
+			agp.aggregates = append(agp.aggregates, a)
+		}
+	}
+	return nil
+}
+
+func sortByGroupParser(param string, agp *AccountGroupParam) error {
+	if param != "count" && common.SliceIndex(groupAggregateNames, param) == -1 {
+		return fmt.Errorf("invalid sort_by (%s)", param)
+	}
+	if param != "count" {
+		agp.sortBy = param
+	}
+	return nil
+}
+
+func countGtGroupParser(param string, agp *AccountGroupParam) error {
+	count, err := strconv.Atoi(param)
+	if err != nil || count < 0 {
+		return fmt.Errorf("failed to parse count_gt (%s)", param)
+	}
+	agp.countGt = count
+	return nil
+}
+
+func countLtGroupParser(param string, agp *AccountGroupParam) error {
+	count, err := strconv.Atoi(param)
+	if err != nil || count < 0 {
+		return fmt.Errorf("failed to parse count_lt (%s)", param)
+	}
+	agp.countLt = count
+	return nil
+}
+
+func offsetGroupParser(param string, agp *AccountGroupParam) error {
+	offset, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("failed to parse offset (%s)", param)
+	}
+	if offset < 0 {
+		return fmt.Errorf("offset should not be negative (%s)", param)
+	}
+	agp.offset = offset
+	return nil
+}
+
 func noopGroupParser(param string, agp *AccountGroupParam) error {
 	return nil
 }
 
 var accountGroupFuncs = map[string]AccountGroupFunc{
-	"sex":       sexGroupParser,
-	"likes":     likesGroupParser,
-	"country":   countryGroupParser,
-	"keys":      keysGroupParser,
-	"joined":    joinedGroupParser,
-	"query_id":  noopGroupParser,
-	"status":    statusGroupParser,
-	"order":     orderGroupParser,
-	"limit":     limitGroupParser,
-	"interests": interestsGroupParser,
-	"birth":     birthGroupParser,
-	"city":      cityGroupParser,
+	"sex":        sexGroupParser,
+	"likes":      likesGroupParser,
+	"country":    countryGroupParser,
+	"keys":       keysGroupParser,
+	"joined":     joinedGroupParser,
+	"query_id":   noopGroupParser,
+	"status":     statusGroupParser,
+	"order":      orderGroupParser,
+	"limit":      limitGroupParser,
+	"interests":  interestsGroupParser,
+	"birth":      birthGroupParser,
+	"city":       cityGroupParser,
+	"aggregates": aggregatesGroupParser,
+	"sort_by":    sortByGroupParser,
+	"count_gt":   countGtGroupParser,
+	"count_lt":   countLtGroupParser,
+	"offset":     offsetGroupParser,
 }
 
+// group dimensions. ties of counts are broken by the values of dimensions in this order
+const (
+	groupDimCountry = iota
+	groupDimCity
+	groupDimInterests
+	groupDimSex
+	groupDimStatus
+	groupDimBirth
+	groupDimJoined
+	groupDimPremium
+	groupDimEmailDomain
+	groupDimPhoneCode
+	numGroupDims
+)
+
+var groupDimNames = [numGroupDims]string{
+	"country",
+	"city",
+	"interests",
+	"sex",
+	"status",
+	"birth",
+	"joined",
+	"premium",
+	"email_domain",
+	"phone_code",
+}
+
+const (
+	premiumStateActive   = "active"
+	premiumStateExpired  = "expired"
+	premiumStateUpcoming = "upcoming" // the period starts in the future
+	premiumStateNever    = "never"
+)
+
 type RawGroupResponse struct {
-	Sex       string `json:"sex,omitempty"`
-	Status    string `json:"status,omitempty"`
-	Interests string `json:"interests,omitempty"`
-	Country   string `json:"country,omitempty"`
-	City      string `json:"city,omitempty"`
-	Count     int    `json:"count,omitempty"`
+	Sex         string `json:"sex,omitempty"`
+	Status      string `json:"status,omitempty"`
+	Interests   string `json:"interests,omitempty"`
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+	Birth       int    `json:"birth,omitempty"`
+	Joined      int    `json:"joined,omitempty"`
+	Premium     string `json:"premium,omitempty"`
+	EmailDomain string `json:"email_domain,omitempty"`
+	PhoneCode   string `json:"phone_code,omitempty"`
+	Count       int    `json:"count,omitempty"`
+
+	Aggregates map[string]float64 `json:"aggregates,omitempty"`
 }
 
 type RawGroupResponses struct {
 	Groups []*RawGroupResponse `json:"groups"`
 }
 
-type GroupResponse struct {
-	Sex       int8
-	Status    int8
-	Interests string
-	Country   string
-	City      string
-}
+// GroupKey is a tuple of the values of group dimensions indexed by groupDim*.
+// Dimensions which are not in keys and null values are empty strings.
+// Values are compared as strings, which keeps the order of sexes and statuses because they are sorted.
+type GroupKey [numGroupDims]string
 
 type GroupResponseCount struct {
-	GroupResponse
+	Key   GroupKey
 	Count int
+	// nil when no aggregates are requested
+	Aggregates map[string]float64
 }
 
-func (gr *GroupResponseCount) ToRawGroupResponse() *RawGroupResponse {
-	r := RawGroupResponse{}
-	if gr.Sex != 0 {
-		r.Sex = common.SEXES[gr.Sex-1]
+const (
+	groupAggregateAvgAge            = "avg_age"
+	groupAggregateMedianAge         = "median_age"
+	groupAggregatePremiumShare      = "premium_share"
+	groupAggregateAvgLikesIn        = "avg_likes_in"
+	groupAggregateAvgLikesOut       = "avg_likes_out"
+	groupAggregateDistinctInterests = "distinct_interests"
+)
+
+var groupAggregateNames = []string{
+	groupAggregateAvgAge,
+	groupAggregateMedianAge,
+	groupAggregatePremiumShare,
+	groupAggregateAvgLikesIn,
+	groupAggregateAvgLikesOut,
+	groupAggregateDistinctInterests,
+}
+
+const secondsPerYear = 365.2425 * 24 * 60 * 60
+
+type groupAccumulator struct {
+	count     int
+	births    []int
+	premium   int
+	likesIn   int
+	likesOut  int
+	interests map[string]struct{}
+}
+
+func (ga *groupAccumulator) add(a *store.StoredAccount, interests []string) {
+	ga.count++
+	ga.births = append(ga.births, a.Birth)
+	if a.Premium_now {
+		ga.premium++
 	}
-	if gr.Status != 0 {
-		r.Status = common.STATUSES[gr.Status-1]
+	ga.likesIn += globals.Ls.LikersCount(a.ID)
+	ga.likesOut += globals.Ls.LikeesCount(a.ID)
+	for _, i := range interests {
+		ga.interests[i] = struct{}{}
 	}
-	r.Interests = gr.Interests
-	r.Country = gr.Country
-	r.City = gr.City
+}
+
+func ageInYears(birth int) float64 {
+	return float64(common.Now()-birth) / secondsPerYear
+}
+
+func (ga *groupAccumulator) aggregate(names []string) map[string]float64 {
+	ret := map[string]float64{}
+	n := float64(ga.count)
+	for _, name := range names {
+		switch name {
+		case groupAggregateAvgAge:
+			sum := 0.0
+			for _, b := range ga.births {
+				sum += ageInYears(b)
+			}
+			ret[name] = sum / n
+		case groupAggregateMedianAge:
+			births := append([]int{}, ga.births...)
+			sort.Ints(births)
+			m := len(births) / 2
+			if len(births)%2 == 1 {
+				ret[name] = ageInYears(births[m])
+			} else {
+				ret[name] = (ageInYears(births[m-1]) + ageInYears(births[m])) / 2
+			}
+		case groupAggregatePremiumShare:
+			ret[name] = float64(ga.premium) / n
+		case groupAggregateAvgLikesIn:
+			ret[name] = float64(ga.likesIn) / n
+		case groupAggregateAvgLikesOut:
+			ret[name] = float64(ga.likesOut) / n
+		case groupAggregateDistinctInterests:
+			ret[name] = float64(len(ga.interests))
+		}
+	}
+	return ret
+}
+
+func (gr *GroupResponseCount) sortValue(sortBy string) float64 {
+	if sortBy == "" {
+		return float64(gr.Count)
+	}
+	return gr.Aggregates[sortBy]
+}
+
+func (gr *GroupResponseCount) ToRawGroupResponse() *RawGroupResponse {
+	r := RawGroupResponse{}
+	r.Sex = gr.Key[groupDimSex]
+	r.Status = gr.Key[groupDimStatus]
+	r.Interests = gr.Key[groupDimInterests]
+	r.Country = gr.Key[groupDimCountry]
+	r.City = gr.Key[groupDimCity]
+	if gr.Key[groupDimBirth] != "" {
+		r.Birth, _ = strconv.Atoi(gr.Key[groupDimBirth])
+	}
+	if gr.Key[groupDimJoined] != "" {
+		r.Joined, _ = strconv.Atoi(gr.Key[groupDimJoined])
+	}
+	r.Premium = gr.Key[groupDimPremium]
+	r.EmailDomain = gr.Key[groupDimEmailDomain]
+	r.PhoneCode = gr.Key[groupDimPhoneCode]
 	r.Count = gr.Count
+	r.Aggregates = gr.Aggregates
 	return &r
 }
 
@@ -214,47 +417,128 @@ func (l *RawGroupResponse) Equal(r *RawGroupResponse) bool {
 	if l.City != r.City {
 		return false
 	}
+	if l.Birth != r.Birth {
+		return false
+	}
+	if l.Joined != r.Joined {
+		return false
+	}
+	if l.Premium != r.Premium {
+		return false
+	}
+	if l.EmailDomain != r.EmailDomain {
+		return false
+	}
+	if l.PhoneCode != r.PhoneCode {
+		return false
+	}
 	if l.Count != r.Count {
 		return false
 	}
+	if len(l.Aggregates) != len(r.Aggregates) {
+		return false
+	}
+	for name, v := range l.Aggregates {
+		if w, found := r.Aggregates[name]; !found || v != w {
+			return false
+		}
+	}
 	return true
 }
 
-func SplitGroupParamsIntoStoreAndFilter(originalAgp *AccountGroupParam) (*AccountGroupParam, store.StoreSource) {
-	agp := *originalAgp
-	//?
-	if agp.likeContain != 0 {
-		mp := globals.Ls.IdsContainAllLikes([]int{agp.likeContain})
+func premiumState(a *store.StoredAccount) string {
+	now := common.Now()
+	if a.Premium_start == 0 {
+		return premiumStateNever
+	} else if a.Premium_end < now {
+		return premiumStateExpired
+	} else if a.Premium_start > now {
+		return premiumStateUpcoming
+	} else {
+		// premium_now can be flipped a little later by the scheduler
+		return premiumStateActive
+	}
+}
 
-		var ids []int
-		for id, _ := range mp {
-			ids = append(ids, id)
+func emailDomain(email string) string {
+	at := strings.IndexByte(email, '@')
+	if at == -1 {
+		return ""
+	}
+	return email[at+1:]
+}
+
+// groupDimValue returns the value of dim except for interests, which an account can have many.
+func groupDimValue(a *store.StoredAccount, dim int) string {
+	switch dim {
+	case groupDimCountry:
+		return globals.As.IdToCountry(a.Country)
+	case groupDimCity:
+		return globals.As.IdToCity(a.City)
+	case groupDimSex:
+		if a.Sex != 0 {
+			return common.SEXES[a.Sex-1]
+		}
+	case groupDimStatus:
+		if a.Status != 0 {
+			return common.STATUSES[a.Status-1]
 		}
+	case groupDimBirth:
+		return strconv.Itoa(time.Unix(int64(a.Birth), 0).UTC().Year())
+	case groupDimJoined:
+		return strconv.Itoa(a.JoinedYear.ToYear())
+	case groupDimPremium:
+		return premiumState(a)
+	case groupDimEmailDomain:
+		return emailDomain(a.Email)
+	case groupDimPhoneCode:
+		return a.Phone.CodeString()
+	}
+	return ""
+}
+
+// indexedIdsFromGroupParams returns ids from the index usable by originalAgp and a copy of the params
+// without the condition covered by the index. found is false when no index can be used.
+func indexedIdsFromGroupParams(originalAgp *AccountGroupParam) (agp *AccountGroupParam, ids []int, found bool) {
+	copied := *originalAgp
+	agp = &copied
 
+	var mp map[int]struct{}
+	//?
+	if agp.likeContain != 0 {
+		mp = globals.Ls.IdsContainAllLikes([]int{agp.likeContain})
 		agp.likeContain = 0
-		return &agp, store.NewArrayStoreSource(ids)
+	} else if len(agp.interestContain) > 0 {
+		// 1/30 if length == 1
+		mp = globals.Is.ContainsAllFromInterests([]string{agp.interestContain})
+		agp.interestContain = ""
+	} else {
+		return agp, nil, false
 	}
 
-	// 1/30 if length == 1
-	if len(agp.interestContain) > 0 {
-		mp := globals.Is.ContainsAllFromInterests([]string{agp.interestContain})
+	for id, _ := range mp {
+		ids = append(ids, id)
+	}
 
-		var ids []int
-		for id, _ := range mp {
-			ids = append(ids, id)
-		}
+	return agp, ids, true
+}
 
-		agp.interestContain = ""
-		return &agp, store.NewArrayStoreSource(ids)
+func SplitGroupParamsIntoStoreAndFilter(originalAgp *AccountGroupParam) (*AccountGroupParam, store.StoreSource) {
+	agp, ids, found := indexedIdsFromGroupParams(originalAgp)
+	if found {
+		return agp, store.NewArrayStoreSource(ids)
 	}
 
 	// default because there're no index
-	return &agp, globals.As.NewRangeAccountStoreSource()
+	return agp, globals.As.NewRangeAccountStoreSource()
 }
 
 func GenFilterFromAccountsGroupParams(agp *AccountGroupParam) store.StoreFilterFunc {
 	return func(id int) bool {
 		me := globals.As.GetStoredAccountWithoutError(id)
+		if me == nil {
+			return false
+		}
 
 		if agp.likeContain != 0 {
 			result := globals.Ls.CheckContainAllLikes(id, []int{agp.likeContain})
@@ -325,81 +609,179 @@ func filterIdsFromGroupParam(originalAgp *AccountGroupParam) []int {
 }
 
 func grouping(ids []int, agp *AccountGroupParam) []GroupResponseCount {
-	mp := map[GroupResponse]int{}
+	_, groupByInterests := agp.keys["interests"]
+
+	mp := map[GroupKey]int{}
+	// only used when aggregates are requested
+	accumulators := map[GroupKey]*groupAccumulator{}
+	add := func(gk GroupKey, a *store.StoredAccount, interests []string) {
+		if len(agp.aggregates) == 0 {
+			mp[gk]++
+			return
+		}
+		ga, found := accumulators[gk]
+		if !found {
+			ga = &groupAccumulator{interests: map[string]struct{}{}}
+			accumulators[gk] = ga
+		}
+		ga.add(a, interests)
+	}
+
 	for _, id := range ids {
 		a := globals.As.GetStoredAccountWithoutError(id)
-		gr := GroupResponse{}
-		var interests []string
-		for key, _ := range agp.keys {
-			switch key {
-			case "country":
-				gr.Country = globals.As.IdToCountry(a.Country)
-			case "city":
-				gr.City = globals.As.IdToCity(a.City)
-			case "sex":
-				gr.Sex = a.Sex
-			case "status":
-				gr.Status = a.Status
-			case "interests":
-				interests = globals.Is.GetInterestStrings(id)
+		var gk GroupKey
+		for _, dim := range agp.dims {
+			if dim != groupDimInterests {
+				gk[dim] = groupDimValue(a, dim)
 			}
 		}
-		if interests == nil {
-			mp[gr]++
+
+		var interests []string
+		if groupByInterests || len(agp.aggregates) > 0 {
+			interests = globals.Is.GetInterestStrings(id)
+		}
+		if !groupByInterests {
+			add(gk, a, interests)
 		} else {
 			for _, i := range interests {
-				gr.Interests = i
-				mp[gr]++
+				gk[groupDimInterests] = i
+				add(gk, a, interests)
 			}
 		}
 	}
 
 	ret := []GroupResponseCount{}
 	for k, v := range mp {
-		ret = append(ret, GroupResponseCount{k, v})
+		ret = append(ret, GroupResponseCount{k, v, nil})
+	}
+	for k, ga := range accumulators {
+		ret = append(ret, GroupResponseCount{k, ga.count, ga.aggregate(agp.aggregates)})
 	}
 
 	return ret
 }
 
-func sorting(grc []GroupResponseCount, agp *AccountGroupParam) {
-	less := func(i, j int) bool {
-		if grc[i].Count != grc[j].Count {
-			return grc[i].Count < grc[j].Count
-		}
-		if grc[i].Country != grc[j].Country {
-			return grc[i].Country < grc[j].Country
-		}
-		if grc[i].City != grc[j].City {
-			return grc[i].City < grc[j].City
-		}
-		if grc[i].Interests != grc[j].Interests {
-			return grc[i].Interests < grc[j].Interests
+// numeric group dims are compared as numbers. the values are digits, possibly with leading zeros like phone codes
+var numericGroupDims = [numGroupDims]bool{groupDimBirth: true, groupDimJoined: true, groupDimPhoneCode: true}
+
+// groupKeyLess compares different values of dim. an empty value comes first.
+func groupKeyLess(dim int, l, r string) bool {
+	if !numericGroupDims[dim] || l == "" || r == "" {
+		return l < r
+	}
+	x, y := strings.TrimLeft(l, "0"), strings.TrimLeft(r, "0")
+	if len(x) != len(y) {
+		return len(x) < len(y)
+	}
+	if x != y {
+		return x < y
+	}
+	// "20" < "020"
+	return len(l) < len(r)
+}
+
+// groupLess returns the order of groups in responses.
+func groupLess(agp *AccountGroupParam) func(l, r *GroupResponseCount) bool {
+	less := func(l, r *GroupResponseCount) bool {
+		if agp.sortBy != "" {
+			x, y := l.sortValue(agp.sortBy), r.sortValue(agp.sortBy)
+			if x != y {
+				return x < y
+			}
 		}
-		if grc[i].Sex != grc[j].Sex {
-			return grc[i].Sex < grc[j].Sex
+		if l.Count != r.Count {
+			return l.Count < r.Count
 		}
-		if grc[i].Status != grc[j].Status {
-			return grc[i].Status < grc[j].Status
+		for dim := 0; dim < numGroupDims; dim++ {
+			if l.Key[dim] != r.Key[dim] {
+				return groupKeyLess(dim, l.Key[dim], r.Key[dim])
+			}
 		}
 		return false
 	}
 
-	sortFunc := less
 	if agp.order == -1 {
-		sortFunc = func(i, j int) bool {
-			return less(j, i)
+		return func(l, r *GroupResponseCount) bool {
+			return less(r, l)
 		}
 	}
+	return less
+}
+
+func sorting(grc []GroupResponseCount, agp *AccountGroupParam) {
+	less := groupLess(agp)
+	sort.Slice(grc, func(i, j int) bool {
+		return less(&grc[i], &grc[j])
+	})
+}
+
+// groupHeap keeps the last group in the response order at the top.
+type groupHeap struct {
+	grc  []GroupResponseCount
+	less func(l, r *GroupResponseCount) bool
+}
+
+func (h *groupHeap) Len() int           { return len(h.grc) }
+func (h *groupHeap) Less(i, j int) bool { return h.less(&h.grc[j], &h.grc[i]) }
+func (h *groupHeap) Swap(i, j int)      { h.grc[i], h.grc[j] = h.grc[j], h.grc[i] }
+
+func (h *groupHeap) Push(x interface{}) {
+	h.grc = append(h.grc, x.(GroupResponseCount))
+}
+
+func (h *groupHeap) Pop() interface{} {
+	last := h.grc[len(h.grc)-1]
+	h.grc = h.grc[:len(h.grc)-1]
+	return last
+}
+
+// selectTopGroups returns the first k groups in the response order, sorted.
+// it takes O(n log k) instead of sorting all groups.
+func selectTopGroups(grc []GroupResponseCount, k int, agp *AccountGroupParam) []GroupResponseCount {
+	if k >= len(grc) {
+		sorting(grc, agp)
+		return grc
+	}
+
+	h := &groupHeap{make([]GroupResponseCount, 0, k), groupLess(agp)}
+	for i := range grc {
+		if h.Len() < k {
+			heap.Push(h, grc[i])
+		} else if h.less(&grc[i], &h.grc[0]) {
+			h.grc[0] = grc[i]
+			heap.Fix(h, 0)
+		}
+	}
+
+	sorting(h.grc, agp)
+	return h.grc
+}
+
+func havingGroups(grc []GroupResponseCount, agp *AccountGroupParam) []GroupResponseCount {
+	if agp.countGt == -1 && agp.countLt == -1 {
+		return grc
+	}
 
-	sort.Slice(grc, sortFunc)
+	var ret []GroupResponseCount
+	for _, g := range grc {
+		if agp.countGt != -1 && g.Count <= agp.countGt {
+			continue
+		}
+		if agp.countLt != -1 && g.Count >= agp.countLt {
+			continue
+		}
+		ret = append(ret, g)
+	}
+	return ret
 }
 
 func accountsGroupParser(queryParams url.Values) (agp *AccountGroupParam, err error) {
 	agp = &AccountGroupParam{
-		keys:  map[string]struct{}{},
-		limit: -1,
-		order: 0,
+		keys:    map[string]struct{}{},
+		limit:   -1,
+		order:   0,
+		countGt: -1,
+		countLt: -1,
 	}
 
 	for field, param := range queryParams {
@@ -428,6 +810,10 @@ func accountsGroupParser(queryParams url.Values) (agp *AccountGroupParam, err er
 		err = fmt.Errorf("order is not specified")
 		return
 	}
+	if agp.sortBy != "" && common.SliceIndex(agp.aggregates, agp.sortBy) == -1 {
+		err = fmt.Errorf("sort_by (%s) is not in aggregates", agp.sortBy)
+		return
+	}
 	if len(agp.keys) == 0 {
 		err = fmt.Errorf("keys is not specified")
 		return
@@ -447,14 +833,29 @@ func AccountsGroupCore(queryParams url.Values) ([]GroupResponseCount, *HlcHttpEr
 	}
 
 	ids := filterIdsFromGroupParam(agp)
-	grc := grouping(ids, agp)
-	sorting(grc, agp)
+	return groupFilteredIds(ids, agp), nil
+}
 
-	limit := agp.limit
-	if limit > len(grc) {
-		limit = len(grc)
+func groupFilteredIds(ids []int, agp *AccountGroupParam) []GroupResponseCount {
+	grc := havingGroups(grouping(ids, agp), agp)
+	if agp.offset >= len(grc) {
+		return []GroupResponseCount{}
+	}
+	// offset + limit can overflow with a large limit
+	k := len(grc)
+	if agp.limit < len(grc)-agp.offset {
+		k = agp.offset + agp.limit
 	}
-	return grc[:limit], nil
+	grc = selectTopGroups(grc, k, agp)
+	return grc[agp.offset:]
+}
+
+func ToRawGroupResponses(grs []GroupResponseCount) *RawGroupResponses {
+	rgr := RawGroupResponses{[]*RawGroupResponse{}}
+	for _, g := range grs {
+		rgr.Groups = append(rgr.Groups, g.ToRawGroupResponse())
+	}
+	return &rgr
 }
 
 func AccountsGroupHandler(c echo.Context) error {
@@ -463,10 +864,5 @@ func AccountsGroupHandler(c echo.Context) error {
 		return c.String(err.HttpStatusCode, "")
 	}
 
-	rgr := RawGroupResponses{[]*RawGroupResponse{}}
-	for _, g := range grs {
-		rgr.Groups = append(rgr.Groups, g.ToRawGroupResponse())
-	}
-
-	return common.JsonResponseWithoutChunking(c, http.StatusOK, &rgr)
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ToRawGroupResponses(grs))
 }
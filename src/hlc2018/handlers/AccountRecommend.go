@@ -8,6 +8,7 @@ import (
 	"hlc2018/globals"
 	"hlc2018/store"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"sort"
@@ -22,6 +23,12 @@ type AccountRecommendParam struct {
 	// adding for recommend
 	city    string
 	country string
+
+	ranker Ranker
+	// 0 means no restriction on distance
+	radiusKm float64
+
+	explain bool
 }
 
 func (arp *AccountRecommendParam) addWhere(s string) {
@@ -70,6 +77,36 @@ func countryRecommendParser(param string, agp *AccountRecommendParam) error {
 	return nil
 }
 
+func rankerRecommendParser(param string, agp *AccountRecommendParam) error {
+	ranker, found := recommendRankers[param]
+	if !found {
+		return fmt.Errorf("ranker (%s) not found", param)
+	}
+	agp.ranker = ranker
+	return nil
+}
+
+func radiusKmRecommendParser(param string, agp *AccountRecommendParam) error {
+	radius, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse radius_km (%s)", param)
+	}
+	if radius <= 0 || math.IsInf(radius, 0) {
+		return fmt.Errorf("radius_km should be positive (%s)", param)
+	}
+	agp.radiusKm = radius
+	return nil
+}
+
+func explainRecommendParser(param string, agp *AccountRecommendParam) error {
+	if param == "1" {
+		agp.explain = true
+	} else if param != "0" {
+		return fmt.Errorf("explain param is not valid (%s)", param)
+	}
+	return nil
+}
+
 func noopRecommendParser(param string, agp *AccountRecommendParam) error {
 	return nil
 }
@@ -77,156 +114,322 @@ func noopRecommendParser(param string, agp *AccountRecommendParam) error {
 type AccountRecommendFunc func(param string, agp *AccountRecommendParam) error
 
 var accountRecommendFuncs = map[string]AccountRecommendFunc{
-	"limit":    limitRecommendParser,
-	"city":     cityRecommendParser,
-	"country":  countryRecommendParser,
-	"query_id": noopRecommendParser,
+	"limit":     limitRecommendParser,
+	"city":      cityRecommendParser,
+	"country":   countryRecommendParser,
+	"query_id":  noopRecommendParser,
+	"ranker":    rankerRecommendParser,
+	"explain":   explainRecommendParser,
+	"radius_km": radiusKmRecommendParser,
+}
+
+func newAccountRecommendParam() *AccountRecommendParam {
+	return &AccountRecommendParam{id: -1, limit: -1, ranker: recommendRankers[DefaultRecommendRanker]}
 }
 
-func accountsRecommendParser(idStr string, queryParams url.Values) (arp *AccountRecommendParam, err error) {
-	arp = &AccountRecommendParam{-1, bytes.Buffer{}, -1, "", ""}
-	if err = idRecommendParser(idStr, arp); err != nil {
-		return
+// parseRecommendParams parses id and calls apply for each query param, which returns false if the field is unknown.
+// suggest and similar share it with their own params.
+func parseRecommendParams(idStr string, queryParams url.Values, arp *AccountRecommendParam, apply func(field, param string) (bool, error)) error {
+	if err := idRecommendParser(idStr, arp); err != nil {
+		return err
 	}
 
 	for field, param := range queryParams {
 		if param[0] == "" {
-			err = fmt.Errorf("parameter cannot be empty (field = %s)", field)
-			return
-		}
-		fun, found := accountRecommendFuncs[field]
-		if !found {
-			err = fmt.Errorf("filter (%s) not found", field)
-			return
+			return fmt.Errorf("parameter cannot be empty (field = %s)", field)
 		}
 		if len(param) != 1 {
-			err = fmt.Errorf("multiple params in filter (%s)", field)
-			return
+			return fmt.Errorf("multiple params in filter (%s)", field)
 		}
-		if err = fun(param[0], arp); err != nil {
-			return
+		found, err := apply(field, param[0])
+		if !found {
+			return fmt.Errorf("filter (%s) not found", field)
+		}
+		if err != nil {
+			return err
 		}
 	}
 	if arp.limit == -1 {
-		err = fmt.Errorf("limit is not specified")
-		return
+		return fmt.Errorf("limit is not specified")
 	}
 	if arp.id == -1 {
-		err = fmt.Errorf("id is not specified")
-		return
+		return fmt.Errorf("id is not specified")
 	}
+	return nil
+}
 
-	return
+func accountsRecommendParser(idStr string, queryParams url.Values) (*AccountRecommendParam, error) {
+	arp := newAccountRecommendParam()
+	err := parseRecommendParams(idStr, queryParams, arp, func(field, param string) (bool, error) {
+		fun, found := accountRecommendFuncs[field]
+		if !found {
+			return false, nil
+		}
+		return true, fun(param, arp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return arp, nil
 }
 
-func AccountsRecommendCore(idStr string, queryParams url.Values) ([]*common.Account, *HlcHttpError) {
+type RawRecommendExplain struct {
+	SharedInterests []string `json:"shared_interests"`
+	PremiumNow      bool     `json:"premium_now"`
+	StatusBucket    int      `json:"status_bucket"`
+	BirthDistance   int      `json:"birth_distance"`
+	// nil when either city is not in the gazetteer
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+}
+
+// RawExplainedAccount is an account in responses of recommend and suggest with explain=1.
+type RawExplainedAccount struct {
+	*common.RawAccount
+	Explain interface{} `json:"explain"`
+}
+
+type RawExplainedAccountsContainer struct {
+	Accounts []*RawExplainedAccount `json:"accounts"`
+	Fallback string                 `json:"fallback,omitempty"`
+}
+
+func explainRecommend(me *store.StoredAccount, c *RecommendCandidate) *RawRecommendExplain {
+	r := RawRecommendExplain{SharedInterests: []string{}}
+	for _, interestId := range globals.Is.CommonInterestIds(me.ID, c.ID) {
+		r.SharedInterests = append(r.SharedInterests, globals.Is.InterestIdToString(interestId))
+	}
+	sort.Strings(r.SharedInterests)
+	r.PremiumNow = c.Premium_now
+	r.StatusBucket = common.StatusRecommendOrder(c.Status)
+	r.BirthDistance = common.AbsInt(me.Birth - c.Birth)
+	if d, ok := accountDistanceKm(me, c.StoredAccount); ok {
+		r.DistanceKm = &d
+	}
+	return &r
+}
+
+func recommendedAccount(c *RecommendCandidate) *common.Account {
+	return &common.Account{
+		ID:            c.ID,
+		Email:         c.Email,
+		Status:        c.Status,
+		Fname:         c.Fname,
+		Sname:         c.Sname,
+		Birth:         c.Birth,
+		Premium_start: c.Premium_start,
+		Premium_end:   c.Premium_end,
+	}
+}
+
+// soughtSexes returns the sexes in the preferences of me, or the opposite sex without preferences.
+func soughtSexes(me *store.StoredAccount) []int8 {
+	if me.Preferences == nil || me.Preferences.Sexes == 0 {
+		return []int8{3 - me.Sex}
+	}
+	var ret []int8
+	for sex := int8(1); sex <= int8(len(common.SEXES)); sex++ {
+		if me.Preferences.SeeksSex(sex) {
+			ret = append(ret, sex)
+		}
+	}
+	return ret
+}
+
+// matchesPreferences checks a against the preferences of me as hard filters.
+// without preferences on sex, only the opposite sex matches.
+func matchesPreferences(me, a *store.StoredAccount) bool {
+	p := me.Preferences
+	if p == nil {
+		return a.Sex+me.Sex == 3
+	}
+	if p.Sexes == 0 {
+		if a.Sex+me.Sex != 3 {
+			return false
+		}
+	} else if !p.SeeksSex(a.Sex) {
+		return false
+	}
+	if p.AgeFrom != 0 || p.AgeTo != 0 {
+		age := int(ageInYears(a.Birth))
+		if age < p.AgeFrom {
+			return false
+		}
+		if p.AgeTo != 0 && age > p.AgeTo {
+			return false
+		}
+	}
+	if p.City != "" && globals.As.GetCityId(p.City) != a.City {
+		return false
+	}
+	if p.Country != "" && globals.As.GetCountryId(p.Country) != a.Country {
+		return false
+	}
+	return true
+}
+
+// accountDistanceKm returns the distance between the cities of me and a if both are in the gazetteer.
+func accountDistanceKm(me, a *store.StoredAccount) (float64, bool) {
+	if me.City == 0 || a.City == 0 {
+		return 0, false
+	}
+	from, found := globals.Gz.Lookup(globals.As.IdToCity(me.City))
+	if !found {
+		return 0, false
+	}
+	to, found := globals.Gz.Lookup(globals.As.IdToCity(a.City))
+	if !found {
+		return 0, false
+	}
+	return store.DistanceKm(from, to), true
+}
+
+// withinRadius checks whether a lives within radiusKm from me.
+// when either city is unknown to the gazetteer, it falls back to whether they live in the same country.
+func withinRadius(me, a *store.StoredAccount, radiusKm float64) bool {
+	if d, ok := accountDistanceKm(me, a); ok {
+		return d <= radiusKm
+	}
+	return me.Country != 0 && me.Country == a.Country
+}
+
+// recommendFromInterests ranks every candidate sharing any interest with account.
+func recommendFromInterests(account *store.StoredAccount, arp *AccountRecommendParam, isCandidate func(a *store.StoredAccount) bool) []RecommendCandidate {
+	var acs []RecommendCandidate
+	for id, cnt := range globals.Is.GetSuggestInterestIds(account.ID) {
+		a := globals.As.GetStoredAccountWithoutError(id)
+		if a == nil || !isCandidate(a) {
+			continue
+		}
+		acs = append(acs, RecommendCandidate{a, cnt})
+	}
+
+	arp.ranker.Rank(account, acs)
+	return acs
+}
+
+// recommendFromIndex visits the tiers of premium_now and status in the order of defaultRanker and
+// stops when the limit is reached. the result is the same as recommendFromInterests with defaultRanker.
+func recommendFromIndex(account *store.StoredAccount, arp *AccountRecommendParam, countryId int, sexes []int8, isCandidate func(a *store.StoredAccount) bool) []RecommendCandidate {
+	var acs []RecommendCandidate
+	globals.Ri.Walk(account, sexes, countryId, func(counts map[int]int) bool {
+		var tier []RecommendCandidate
+		for id, cnt := range counts {
+			a := globals.As.GetStoredAccountWithoutError(id)
+			if a == nil || !isCandidate(a) {
+				continue
+			}
+			tier = append(tier, RecommendCandidate{a, cnt})
+		}
+		defaultRanker{}.Rank(account, tier)
+		acs = append(acs, tier...)
+		return len(acs) < arp.limit
+	})
+	return acs
+}
+
+// recommendCore returns the ranked candidates up to the limit and the cold-start fallback level if it is used.
+func recommendCore(idStr string, queryParams url.Values) (*AccountRecommendParam, *store.StoredAccount, []RecommendCandidate, string, *HlcHttpError) {
 	arp, err := accountsRecommendParser(idStr, queryParams)
 	if err != nil {
 		log.Print(err)
-		return nil, &HlcHttpError{http.StatusBadRequest, err}
+		return nil, nil, nil, "", &HlcHttpError{http.StatusBadRequest, err}
 	}
 
 	account, err := globals.As.GetStoredAccount(arp.id)
 	if err != nil {
-		return nil, &HlcHttpError{http.StatusNotFound, err}
+		return nil, nil, nil, "", &HlcHttpError{http.StatusNotFound, err}
 	}
 
 	arpCountryId := globals.As.GetCountryId(arp.country)
 	arpCityId := globals.As.GetCityId(arp.city)
 
-	interestsCounts := globals.Is.GetSuggestInterestIds(account.ID)
-	filteredInterestingsCounts := map[int]int{}
-	for k, v := range interestsCounts {
-		a := globals.As.GetStoredAccountWithoutError(k)
-		if k == account.ID {
-			continue
+	isCandidate := func(a *store.StoredAccount) bool {
+		if a.ID == account.ID || discoveryExcluded(account.ID, a.ID) {
+			return false
 		}
-		if a.Sex+account.Sex != 3 {
-			continue
+		if !matchesPreferences(account, a) {
+			return false
+		}
+		if arp.radiusKm > 0 && !withinRadius(account, a, arp.radiusKm) {
+			return false
 		}
 		if arpCountryId != 0 {
 			if arpCountryId != a.Country {
-				continue
+				return false
 			}
 		}
 		if arpCityId != 0 {
 			if arpCityId != a.City {
-				continue
+				return false
 			}
 		}
-		filteredInterestingsCounts[k] = v
-	}
-
-	if len(filteredInterestingsCounts) == 0 {
-		return nil, nil
+		return true
 	}
 
-	type StoredAccountCount struct {
-		*store.StoredAccount
-		count int
+	if globals.Is.InterestsCount(account.ID) == 0 && len(ColdStartFallbacks) > 0 {
+		ids, fallback := coldStartIds(account, arp.limit, isCandidate)
+		var acs []RecommendCandidate
+		for _, id := range ids {
+			acs = append(acs, RecommendCandidate{globals.As.GetStoredAccountWithoutError(id), 0})
+		}
+		return arp, account, acs, fallback, nil
 	}
 
-	var acs []StoredAccountCount
-	for id, cnt := range filteredInterestingsCounts {
-		acs = append(acs, StoredAccountCount{globals.As.GetStoredAccountWithoutError(id), cnt})
+	var acs []RecommendCandidate
+	if _, isDefault := arp.ranker.(defaultRanker); isDefault && globals.Ri.Built() {
+		acs = recommendFromIndex(account, arp, arpCountryId, soughtSexes(account), isCandidate)
+	} else {
+		acs = recommendFromInterests(account, arp, isCandidate)
 	}
 
-	sort.Slice(acs, func(i, j int) bool {
-		if acs[i].Premium_now != acs[j].Premium_now {
-			return acs[i].Premium_now
-		}
-		c, d := acs[i].Status, acs[j].Status
-		if c != d {
-			if c == 3 {
-				return true
-			} else if d == 3 {
-				return false
-			} else {
-				//2,1 or 1,2
-				return c == 1
-			}
-		}
-		x := interestsCounts[acs[i].ID]
-		y := interestsCounts[acs[j].ID]
-		if x != y {
-			return x > y
-		}
-		a := common.AbsInt(account.Birth - acs[i].Birth)
-		b := common.AbsInt(account.Birth - acs[j].Birth)
-		return a < b
-	})
-
 	retLen := arp.limit
 	if retLen > len(acs) {
 		retLen = len(acs)
 	}
 
+	return arp, account, acs[:retLen], "", nil
+}
+
+func AccountsRecommendCore(idStr string, queryParams url.Values) ([]*common.Account, *HlcHttpError) {
+	_, _, acs, _, err := recommendCore(idStr, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
 	var converted []*common.Account
-	for i := 0; i < retLen; i++ {
-		converted = append(converted, &common.Account{
-			ID:            acs[i].ID,
-			Email:         acs[i].Email,
-			Status:        acs[i].Status,
-			Fname:         acs[i].Fname,
-			Sname:         acs[i].Sname,
-			Birth:         acs[i].Birth,
-			Premium_start: acs[i].Premium_start,
-			Premium_end:   acs[i].Premium_end,
-		})
+	for i := range acs {
+		converted = append(converted, recommendedAccount(&acs[i]))
 	}
 
 	return converted, nil
 }
 
 func AccountsRecommendHandler(c echo.Context) error {
-	acs, err := AccountsRecommendCore(c.Param("id"), c.QueryParams())
+	arp, me, acs, fallback, err := recommendCore(c.Param("id"), c.QueryParams())
 	if err != nil {
 		return c.String(err.HttpStatusCode, "")
 	}
 
-	rac := common.RawAccountsContainer{[]*common.RawAccount{}}
-	for _, ac := range acs {
-		rac.Accounts = append(rac.Accounts, ac.ToRawAccount())
+	if arp.explain {
+		rac := RawExplainedAccountsContainer{[]*RawExplainedAccount{}, fallback}
+		for i := range acs {
+			var explain interface{}
+			if fallback != "" {
+				explain = explainColdStart(fallback, acs[i].ID)
+			} else {
+				explain = explainRecommend(me, &acs[i])
+			}
+			rac.Accounts = append(rac.Accounts, &RawExplainedAccount{
+				recommendedAccount(&acs[i]).ToRawAccount(),
+				explain,
+			})
+		}
+		return common.JsonResponseWithoutChunking(c, http.StatusOK, &rac)
+	}
+
+	rac := RawAccountsContainerWithFallback{[]*common.RawAccount{}, fallback}
+	for i := range acs {
+		rac.Accounts = append(rac.Accounts, recommendedAccount(&acs[i]).ToRawAccount())
 	}
 
 	return common.JsonResponseWithoutChunking(c, http.StatusOK, &rac)
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/globals"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type RawBlocksContainer struct {
+	Blocks []int `json:"blocks"`
+}
+
+// parseBlocks validates the blocking account and the blocked accounts.
+func parseBlocks(idStr string, j []byte) (int, []int, *HlcHttpError) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return 0, nil, &HlcHttpError{http.StatusNotFound, err}
+	}
+	if a, err := globals.As.GetStoredAccount(id); err != nil || a == nil {
+		return 0, nil, &HlcHttpError{http.StatusNotFound, fmt.Errorf("account not found")}
+	}
+
+	var rbc RawBlocksContainer
+	if err := json.Unmarshal(j, &rbc); err != nil {
+		return 0, nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	for _, other := range rbc.Blocks {
+		if other == id {
+			return 0, nil, &HlcHttpError{http.StatusBadRequest, fmt.Errorf("%d cannot block itself", id)}
+		}
+		if a, err := globals.As.GetStoredAccount(other); err != nil || a == nil {
+			return 0, nil, &HlcHttpError{http.StatusBadRequest, fmt.Errorf("blocked account (%d) not found", other)}
+		}
+	}
+	return id, rbc.Blocks, nil
+}
+
+func AccountsBlockCore(idStr string, j []byte) *HlcHttpError {
+	id, blocks, herr := parseBlocks(idStr, j)
+	if herr != nil {
+		return herr
+	}
+	for _, other := range blocks {
+		globals.Bs.Block(id, other)
+	}
+	return nil
+}
+
+func AccountsUnblockCore(idStr string, j []byte) *HlcHttpError {
+	id, blocks, herr := parseBlocks(idStr, j)
+	if herr != nil {
+		return herr
+	}
+	for _, other := range blocks {
+		globals.Bs.Unblock(id, other)
+	}
+	return nil
+}
+
+func AccountsBlockHandler(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	herr := AccountsBlockCore(c.Param("id"), body)
+	if herr != nil {
+		log.Print(herr)
+		return c.String(herr.HttpStatusCode, "")
+	}
+	return c.JSON(http.StatusCreated, map[string]struct{}{})
+}
+
+func AccountsUnblockHandler(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	herr := AccountsUnblockCore(c.Param("id"), body)
+	if herr != nil {
+		log.Print(herr)
+		return c.String(herr.HttpStatusCode, "")
+	}
+	return c.JSON(http.StatusAccepted, map[string]struct{}{})
+}
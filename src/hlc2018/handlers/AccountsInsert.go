@@ -20,6 +20,11 @@ func AccountsInsertHandlerCore(j []byte) error {
 	if err != nil {
 		return err
 	}
+	if ra.Email != "" {
+		if err := common.ValidateEmail(ra.Email); err != nil {
+			return err
+		}
+	}
 	interests := ra.ToInterests()
 	likes := ra.ToLikes()
 
@@ -29,6 +34,8 @@ func AccountsInsertHandlerCore(j []byte) error {
 	for _, i := range interests {
 		globals.Is.InsertCommonInterest(i)
 	}
+	globals.Ri.Reindex(a.ID)
+	globals.Ps.Schedule(a.ID, common.Now())
 	for _, i := range likes {
 		if err := globals.Ls.InsertCommonLike(i); err != nil {
 			return err
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// RawPassesContainer has the same shape as RawLikesContainer. a pass means liker doesn't want likee.
+type RawPassesContainer struct {
+	Passes []struct {
+		Likee int `json:"likee"`
+		Ts    int `json:"ts"`
+		Liker int `json:"liker"`
+	} `json:"passes"`
+}
+
+func (rpc *RawPassesContainer) ToLikes() []*common.Like {
+	var ret []*common.Like
+	for _, l := range rpc.Passes {
+		ret = append(ret, &common.Like{AccountIdFrom: l.Liker, AccountIdTo: l.Likee, Ts: l.Ts})
+	}
+	return ret
+}
+
+// discoveryExcluded returns true if other must not be recommended or suggested to id.
+func discoveryExcluded(id, other int) bool {
+	return globals.Bs.IsBlocked(id, other) || globals.Ls.IsPassed(id, other)
+}
+
+func AccountsPassesHandlerCore(j []byte) error {
+	var rpc RawPassesContainer
+	if err := json.Unmarshal([]byte(j), &rpc); err != nil {
+		return err
+	}
+
+	passes := rpc.ToLikes()
+	for _, i := range passes {
+		if err := globals.Ls.IsValidCommonLike(i); err != nil {
+			return err
+		}
+	}
+	for _, i := range passes {
+		globals.Ls.InsertPass(i.AccountIdFrom, i.AccountIdTo, i.Ts)
+	}
+
+	return nil
+}
+
+func AccountsPassesHandler(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = AccountsPassesHandlerCore(body)
+	if err != nil {
+		log.Print(err)
+		return c.String(http.StatusBadRequest, "")
+	}
+	return c.JSON(http.StatusAccepted, map[string]struct{}{})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+type RawPremiumPurchase struct {
+	Days int `json:"days"`
+}
+
+// AccountsPremiumCore extends the current or future premium period by the purchased days,
+// or starts a new one now after the period expired.
+func AccountsPremiumCore(idStr string, j []byte) (*common.RawPremium, *HlcHttpError) {
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, &HlcHttpError{http.StatusNotFound, err}
+	}
+	a, err := globals.As.GetStoredAccount(id)
+	if err != nil || a == nil {
+		return nil, &HlcHttpError{http.StatusNotFound, fmt.Errorf("account not found")}
+	}
+
+	var rpp RawPremiumPurchase
+	if err := json.Unmarshal(j, &rpp); err != nil {
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	if rpp.Days <= 0 {
+		return nil, &HlcHttpError{http.StatusBadRequest, fmt.Errorf("days should be positive (%d)", rpp.Days)}
+	}
+
+	now := common.Now()
+	start, end := now, now+rpp.Days*secondsPerDay
+	if a.Premium_start != 0 && a.Premium_end >= now {
+		start, end = a.Premium_start, a.Premium_end+rpp.Days*secondsPerDay
+	}
+	if err := globals.As.SetPremium(id, start, end, now); err != nil {
+		return nil, &HlcHttpError{http.StatusNotFound, err}
+	}
+	globals.Ri.Reindex(id)
+	globals.Ps.Schedule(id, now)
+
+	return &common.RawPremium{Start: start, Finish: end}, nil
+}
+
+func AccountsPremiumHandler(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ret, herr := AccountsPremiumCore(c.Param("id"), body)
+	if herr != nil {
+		log.Print(herr)
+		return c.String(herr.HttpStatusCode, "")
+	}
+	return c.JSON(http.StatusAccepted, ret)
+}
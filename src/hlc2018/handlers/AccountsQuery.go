@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"hlc2018/store"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// QueryNode is a boolean expression over the predicates of /accounts/filter/.
+// Exactly one of And, Or, Not and Field must be set. A leaf is {"field": "city_eq", "value": "..."}.
+type QueryNode struct {
+	And   []*QueryNode `json:"and,omitempty"`
+	Or    []*QueryNode `json:"or,omitempty"`
+	Not   *QueryNode   `json:"not,omitempty"`
+	Field string       `json:"field,omitempty"`
+	Value string       `json:"value,omitempty"`
+}
+
+type RawAccountsQuery struct {
+	Where  *QueryNode `json:"where"`
+	Order  int        `json:"order"`
+	Limit  int        `json:"limit"`
+	Fields []string   `json:"fields"`
+}
+
+type compiledQueryNode struct {
+	filter store.StoreFilterFunc
+	// ids are sorted in descending order. they are valid only when indexed is true
+	ids     []int
+	indexed bool
+}
+
+var queryFieldSelects = map[string][]string{
+	"sex":     {"sex"},
+	"status":  {"status"},
+	"fname":   {"fname"},
+	"sname":   {"sname"},
+	"phone":   {"phone"},
+	"city":    {"city"},
+	"country": {"country"},
+	"birth":   {"birth"},
+	"premium": {"premium_start", "premium_end"},
+}
+
+func compileQueryLeaf(node *QueryNode, selects map[string]struct{}) (*compiledQueryNode, error) {
+	if node.Field == "limit" || node.Field == "query_id" {
+		return nil, fmt.Errorf("%s cannot be used in where", node.Field)
+	}
+	fun, found := filterFuncs[node.Field]
+	if !found {
+		return nil, fmt.Errorf("filter (%s) not found", node.Field)
+	}
+	if node.Value == "" {
+		return nil, fmt.Errorf("parameter cannot be empty (field = %s)", node.Field)
+	}
+
+	afp := &AccountsFilterParams{
+		selects: selects,
+		limit:   -1,
+	}
+	if err := fun(node.Value, afp); err != nil {
+		return nil, err
+	}
+
+	_, ids, indexed := indexedIdsFromFilterParams(afp)
+	return &compiledQueryNode{GenFilterFromAccountsFilterParams(afp), ids, indexed}, nil
+}
+
+func compileQueryChildren(nodes []*QueryNode, selects map[string]struct{}) ([]*compiledQueryNode, error) {
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("and / or should have at least one child")
+	}
+	var ret []*compiledQueryNode
+	for _, n := range nodes {
+		c, err := compileQueryNode(n, selects)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, c)
+	}
+	return ret, nil
+}
+
+func compileQueryAnd(children []*compiledQueryNode) *compiledQueryNode {
+	ret := &compiledQueryNode{}
+	// the smallest index is enough. the other conditions are checked by the filter
+	for _, c := range children {
+		if c.indexed && (!ret.indexed || len(c.ids) < len(ret.ids)) {
+			ret.ids = c.ids
+			ret.indexed = true
+		}
+	}
+	ret.filter = func(id int) bool {
+		for _, c := range children {
+			if !c.filter(id) {
+				return false
+			}
+		}
+		return true
+	}
+	return ret
+}
+
+func compileQueryOr(children []*compiledQueryNode) *compiledQueryNode {
+	ret := &compiledQueryNode{indexed: true}
+	mp := map[int]struct{}{}
+	for _, c := range children {
+		if !c.indexed {
+			ret.indexed = false
+			break
+		}
+		for _, id := range c.ids {
+			mp[id] = struct{}{}
+		}
+	}
+	if ret.indexed {
+		for id, _ := range mp {
+			ret.ids = append(ret.ids, id)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ret.ids)))
+	}
+	ret.filter = func(id int) bool {
+		for _, c := range children {
+			if c.filter(id) {
+				return true
+			}
+		}
+		return false
+	}
+	return ret
+}
+
+func compileQueryNode(node *QueryNode, selects map[string]struct{}) (*compiledQueryNode, error) {
+	if node == nil {
+		return nil, fmt.Errorf("query node is empty")
+	}
+
+	kinds := 0
+	if node.And != nil {
+		kinds++
+	}
+	if node.Or != nil {
+		kinds++
+	}
+	if node.Not != nil {
+		kinds++
+	}
+	if node.Field != "" {
+		kinds++
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("query node should have exactly one of and, or, not and field")
+	}
+
+	switch {
+	case node.And != nil:
+		children, err := compileQueryChildren(node.And, selects)
+		if err != nil {
+			return nil, err
+		}
+		return compileQueryAnd(children), nil
+	case node.Or != nil:
+		children, err := compileQueryChildren(node.Or, selects)
+		if err != nil {
+			return nil, err
+		}
+		return compileQueryOr(children), nil
+	case node.Not != nil:
+		child, err := compileQueryNode(node.Not, selects)
+		if err != nil {
+			return nil, err
+		}
+		// an index cannot be used for negation
+		return &compiledQueryNode{filter: func(id int) bool {
+			return !child.filter(id)
+		}}, nil
+	default:
+		return compileQueryLeaf(node, selects)
+	}
+}
+
+func accountsQueryParser(j []byte) (*RawAccountsQuery, map[string]struct{}, error) {
+	var q RawAccountsQuery
+	if err := json.Unmarshal(j, &q); err != nil {
+		return nil, nil, err
+	}
+	if q.Where == nil {
+		return nil, nil, fmt.Errorf("where is not specified")
+	}
+	if q.Limit <= 0 {
+		return nil, nil, fmt.Errorf("limit should be positive (%d)", q.Limit)
+	}
+	if q.Order == 0 {
+		q.Order = -1
+	}
+	if q.Order != 1 && q.Order != -1 {
+		return nil, nil, fmt.Errorf("invalid order (%d)", q.Order)
+	}
+
+	// without fields, the same columns as /accounts/filter/ are returned
+	var selects map[string]struct{}
+	if q.Fields != nil {
+		selects = map[string]struct{}{}
+		for _, f := range q.Fields {
+			columns, found := queryFieldSelects[f]
+			if !found {
+				return nil, nil, fmt.Errorf("invalid field (%s)", f)
+			}
+			for _, c := range columns {
+				selects[c] = struct{}{}
+			}
+		}
+	}
+
+	return &q, selects, nil
+}
+
+func AccountsQueryCore(j []byte) (*common.AccountContainer, *HlcHttpError) {
+	q, selects, err := accountsQueryParser(j)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+
+	leafSelects := map[string]struct{}{}
+	compiled, err := compileQueryNode(q.Where, leafSelects)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	if selects == nil {
+		selects = leafSelects
+	}
+
+	var ss store.StoreSource
+	if compiled.indexed {
+		ids := compiled.ids
+		if q.Order == 1 {
+			ids = make([]int, len(compiled.ids))
+			for i, id := range compiled.ids {
+				ids[len(ids)-1-i] = id
+			}
+		}
+		ss = store.NewArrayStoreSource(ids)
+	} else if q.Order == 1 {
+		ss = globals.As.NewAscendingRangeAccountStoreSource()
+	} else {
+		ss = globals.As.NewRangeAccountStoreSource()
+	}
+
+	sff := func(id int) bool {
+		if globals.As.GetStoredAccountWithoutError(id) == nil {
+			return false
+		}
+		return compiled.filter(id)
+	}
+
+	return accountContainerFromIds(store.ApplyFilter(ss, sff, q.Limit), selects), nil
+}
+
+func AccountsQueryHandler(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	afas, herr := AccountsQueryCore(body)
+	if herr != nil {
+		return c.String(herr.HttpStatusCode, "")
+	}
+
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, afas.ToRawAccountsContainer())
+}
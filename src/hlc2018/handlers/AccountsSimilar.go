@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+)
+
+const (
+	interestSimilarityJaccard = "jaccard"
+	interestSimilarityIdf     = "idf"
+)
+
+type AccountSimilarParam struct {
+	*AccountRecommendParam
+	interestMetric string
+}
+
+type AccountSimilarFunc func(param string, asp *AccountSimilarParam) error
+
+// recommend params usable by similar
+var similarRecommendFields = []string{"limit", "city", "country", "query_id"}
+
+var accountSimilarFuncs = map[string]AccountSimilarFunc{
+	"metric": metricSimilarParser,
+}
+
+func init() {
+	for _, field := range similarRecommendFields {
+		recommendFunc := accountRecommendFuncs[field]
+		accountSimilarFuncs[field] = func(param string, asp *AccountSimilarParam) error {
+			return recommendFunc(param, asp.AccountRecommendParam)
+		}
+	}
+}
+
+func metricSimilarParser(param string, asp *AccountSimilarParam) error {
+	if param != interestSimilarityJaccard && param != interestSimilarityIdf {
+		return fmt.Errorf("metric (%s) not found", param)
+	}
+	asp.interestMetric = param
+	return nil
+}
+
+func accountsSimilarParser(idStr string, queryParams url.Values) (*AccountSimilarParam, error) {
+	asp := &AccountSimilarParam{AccountRecommendParam: newAccountRecommendParam(), interestMetric: interestSimilarityJaccard}
+	err := parseRecommendParams(idStr, queryParams, asp.AccountRecommendParam, func(field, param string) (bool, error) {
+		fun, found := accountSimilarFuncs[field]
+		if !found {
+			return false, nil
+		}
+		return true, fun(param, asp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asp, nil
+}
+
+type RawSimilarAccount struct {
+	*common.RawAccount
+	Similarity float64 `json:"similarity"`
+}
+
+type RawSimilarAccountsContainer struct {
+	Accounts []*RawSimilarAccount `json:"accounts"`
+}
+
+// AccountsSimilarCore ranks accounts of any sex by the overlap of interests with the given account.
+func AccountsSimilarCore(idStr string, queryParams url.Values) (*RawSimilarAccountsContainer, *HlcHttpError) {
+	asp, err := accountsSimilarParser(idStr, queryParams)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+
+	account, err := globals.As.GetStoredAccount(asp.id)
+	if err != nil {
+		return nil, &HlcHttpError{http.StatusNotFound, err}
+	}
+
+	var similarities map[int]float64
+	if asp.interestMetric == interestSimilarityIdf {
+		similarities = globals.Is.IdfSimilarities(account.ID)
+	} else {
+		similarities = globals.Is.JaccardSimilarities(account.ID)
+	}
+
+	arpCountryId := globals.As.GetCountryId(asp.country)
+	arpCityId := globals.As.GetCityId(asp.city)
+
+	var ids []int
+	for id, similarity := range similarities {
+		if similarity <= 0 || globals.Bs.IsBlocked(account.ID, id) {
+			continue
+		}
+		a := globals.As.GetStoredAccountWithoutError(id)
+		if a == nil || arpCountryId != 0 && arpCountryId != a.Country {
+			continue
+		}
+		if arpCityId != 0 && arpCityId != a.City {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		x, y := similarities[ids[i]], similarities[ids[j]]
+		if x != y {
+			return x > y
+		}
+		return ids[i] > ids[j]
+	})
+	if len(ids) > asp.limit {
+		ids = ids[:asp.limit]
+	}
+
+	rac := &RawSimilarAccountsContainer{[]*RawSimilarAccount{}}
+	for _, id := range ids {
+		rac.Accounts = append(rac.Accounts, &RawSimilarAccount{profileAccount(id).ToRawAccount(), similarities[id]})
+	}
+	return rac, nil
+}
+
+func AccountsSimilarHandler(c echo.Context) error {
+	ret, err := AccountsSimilarCore(c.Param("id"), c.QueryParams())
+	if err != nil {
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
@@ -1,38 +1,164 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/labstack/echo"
 	"hlc2018/common"
 	"hlc2018/globals"
+	"hlc2018/store"
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 )
 
-func AccountsSuggestCore(idStr string, queryParams url.Values) ([]*common.Account, *HlcHttpError) {
-	arp, err := accountsRecommendParser(idStr, queryParams)
+type AccountSuggestParam struct {
+	*AccountRecommendParam
+	metric store.LikeSimilarityMetric
+	approx bool
+}
+
+type AccountSuggestFunc func(param string, asp *AccountSuggestParam) error
+
+// recommend params usable by suggest
+var suggestRecommendFields = []string{"limit", "city", "country", "query_id", "explain"}
+
+var accountSuggestFuncs = map[string]AccountSuggestFunc{
+	"metric": metricSuggestParser,
+	"approx": approxSuggestParser,
+}
+
+func init() {
+	for _, field := range suggestRecommendFields {
+		recommendFunc := accountRecommendFuncs[field]
+		accountSuggestFuncs[field] = func(param string, asp *AccountSuggestParam) error {
+			return recommendFunc(param, asp.AccountRecommendParam)
+		}
+	}
+}
+
+// approxSuggestParser enables the approximate search of similar likers when LSH is enabled.
+func approxSuggestParser(param string, asp *AccountSuggestParam) error {
+	if param == "1" {
+		asp.approx = true
+	} else if param != "0" {
+		return fmt.Errorf("approx param is not valid (%s)", param)
+	}
+	return nil
+}
+
+func metricSuggestParser(param string, asp *AccountSuggestParam) error {
+	metric, found := store.LikeSimilarityMetrics[param]
+	if !found {
+		return fmt.Errorf("metric (%s) not found", param)
+	}
+	asp.metric = metric
+	return nil
+}
+
+func accountsSuggestParser(idStr string, queryParams url.Values) (*AccountSuggestParam, error) {
+	asp := &AccountSuggestParam{
+		AccountRecommendParam: newAccountRecommendParam(),
+		metric:                store.LikeSimilarityMetrics[store.DefaultLikeSimilarityMetric],
+	}
+	err := parseRecommendParams(idStr, queryParams, asp.AccountRecommendParam, func(field, param string) (bool, error) {
+		fun, found := accountSuggestFuncs[field]
+		if !found {
+			return false, nil
+		}
+		return true, fun(param, asp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asp, nil
+}
+
+type RawLikeContribution struct {
+	Likee        int     `json:"likee"`
+	Contribution float64 `json:"contribution"`
+}
+
+type RawSimilarLiker struct {
+	ID            int                    `json:"id"`
+	Similarity    float64                `json:"similarity"`
+	Contributions []*RawLikeContribution `json:"contributions"`
+}
+
+type RawSuggestExplain struct {
+	SimilarLikers []*RawSimilarLiker `json:"similar_likers"`
+}
+
+// explainSuggest lists the similar likers who like suggested, in the order of similarity.
+func explainSuggest(asp *AccountSuggestParam, suggested int, similarities map[int]float64) *RawSuggestExplain {
+	r := RawSuggestExplain{[]*RawSimilarLiker{}}
+	for _, liker := range globals.Ls.Likers(suggested) {
+		similarity, found := similarities[liker]
+		if !found {
+			continue
+		}
+		sl := RawSimilarLiker{liker, similarity, []*RawLikeContribution{}}
+		for _, lc := range globals.Ls.LikeSimilarityContributions(asp.id, liker, asp.metric) {
+			sl.Contributions = append(sl.Contributions, &RawLikeContribution{lc.Likee, lc.Contribution})
+		}
+		r.SimilarLikers = append(r.SimilarLikers, &sl)
+	}
+	sort.Slice(r.SimilarLikers, func(i, j int) bool {
+		return r.SimilarLikers[i].Similarity > r.SimilarLikers[j].Similarity
+	})
+	return &r
+}
+
+// suggestCore returns suggested ids, the similarities of likers which passed the filter and
+// the cold-start fallback level if it is used.
+func suggestCore(idStr string, queryParams url.Values) (*AccountSuggestParam, *store.StoredAccount, []int, map[int]float64, string, *HlcHttpError) {
+	asp, err := accountsSuggestParser(idStr, queryParams)
 	if err != nil {
 		log.Print(err)
-		return nil, &HlcHttpError{http.StatusBadRequest, err}
+		return nil, nil, nil, nil, "", &HlcHttpError{http.StatusBadRequest, err}
 	}
 
-	account, err := globals.As.GetStoredAccount(arp.id)
+	account, err := globals.As.GetStoredAccount(asp.id)
 	if err != nil {
-		return nil, &HlcHttpError{http.StatusNotFound, err}
+		return nil, nil, nil, nil, "", &HlcHttpError{http.StatusNotFound, err}
 	}
 
-	orderedLiker := globals.Ls.OrderByLikeSimilarity(account.ID)
-	if len(orderedLiker) == 0 {
-		return nil, nil
+	arpCountryId := globals.As.GetCountryId(asp.country)
+	arpCityId := globals.As.GetCityId(asp.city)
+
+	if globals.Ls.LikeesCount(account.ID) == 0 && len(ColdStartFallbacks) > 0 {
+		ids, fallback := coldStartIds(account, asp.limit, func(a *store.StoredAccount) bool {
+			if a.ID == account.ID || discoveryExcluded(account.ID, a.ID) {
+				return false
+			}
+			if arpCountryId != 0 && arpCountryId != a.Country {
+				return false
+			}
+			if arpCityId != 0 && arpCityId != a.City {
+				return false
+			}
+			return true
+		})
+		return asp, account, ids, nil, fallback, nil
 	}
 
-	arpCountryId := globals.As.GetCountryId(arp.country)
-	arpCityId := globals.As.GetCityId(arp.city)
+	var similarities map[int]float64
+	var orderedLiker []int
+	if asp.approx {
+		similarities = globals.Ls.ApproximateLikeSimilarities(account.ID, asp.metric)
+		orderedLiker = store.OrderBySimilarity(similarities)
+	} else {
+		similarities, orderedLiker = globals.Ls.CachedLikeSimilarities(account.ID, asp.metric)
+	}
+	if len(orderedLiker) == 0 {
+		return asp, account, nil, nil, "", nil
+	}
 
 	var filteredOrderedLiker []int
+	filteredSimilarities := map[int]float64{}
 	for _, id := range orderedLiker {
 		a := globals.As.GetStoredAccountWithoutError(id)
-		if a.Sex != account.Sex {
+		if a == nil || a.Sex != account.Sex {
 			continue
 		}
 		if arpCountryId != 0 {
@@ -47,45 +173,76 @@ func AccountsSuggestCore(idStr string, queryParams url.Values) ([]*common.Accoun
 		}
 
 		filteredOrderedLiker = append(filteredOrderedLiker, id)
+		filteredSimilarities[id] = similarities[id]
 	}
 
 	if len(filteredOrderedLiker) == 0 {
-		return nil, nil
+		return asp, account, nil, nil, "", nil
 	}
 
 	orderedRetIds := []int{}
 	retIds := map[int]struct{}{}
 	for _, id := range filteredOrderedLiker {
-		globals.Ls.GetNotLiked(account.ID, id, &retIds, &orderedRetIds, arp.limit)
-		if len(retIds) == arp.limit {
+		globals.Ls.GetNotLiked(account.ID, id, &retIds, &orderedRetIds, asp.limit, discoveryExcluded)
+		if len(retIds) == asp.limit {
 			break
 		}
 	}
 
+	return asp, account, orderedRetIds, filteredSimilarities, "", nil
+}
+
+func suggestedAccount(id int) *common.Account {
+	a := globals.As.GetStoredAccountWithoutError(id)
+	return &common.Account{
+		ID:     a.ID,
+		Email:  a.Email,
+		Status: a.Status,
+		Fname:  a.Fname,
+		Sname:  a.Sname,
+	}
+}
+
+func AccountsSuggestCore(idStr string, queryParams url.Values) ([]*common.Account, *HlcHttpError) {
+	_, _, ids, _, _, err := suggestCore(idStr, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
 	var ret []*common.Account
-	for _, id := range orderedRetIds {
-		a := globals.As.GetStoredAccountWithoutError(id)
-		ret = append(ret, &common.Account{
-			ID:     a.ID,
-			Email:  a.Email,
-			Status: a.Status,
-			Fname:  a.Fname,
-			Sname:  a.Sname,
-		})
+	for _, id := range ids {
+		ret = append(ret, suggestedAccount(id))
 	}
 
 	return ret, nil
 }
 
 func AccountsSuggestHandler(c echo.Context) error {
-	acs, err := AccountsSuggestCore(c.Param("id"), c.QueryParams())
+	asp, _, ids, similarities, fallback, err := suggestCore(c.Param("id"), c.QueryParams())
 	if err != nil {
 		return c.String(err.HttpStatusCode, "")
 	}
 
-	rac := common.RawAccountsContainer{[]*common.RawAccount{}}
-	for _, ac := range acs {
-		rac.Accounts = append(rac.Accounts, ac.ToRawAccount())
+	if asp.explain {
+		rac := RawExplainedAccountsContainer{[]*RawExplainedAccount{}, fallback}
+		for _, id := range ids {
+			var explain interface{}
+			if fallback != "" {
+				explain = explainColdStart(fallback, id)
+			} else {
+				explain = explainSuggest(asp, id, similarities)
+			}
+			rac.Accounts = append(rac.Accounts, &RawExplainedAccount{
+				suggestedAccount(id).ToRawAccount(),
+				explain,
+			})
+		}
+		return common.JsonResponseWithoutChunking(c, http.StatusOK, &rac)
+	}
+
+	rac := RawAccountsContainerWithFallback{[]*common.RawAccount{}, fallback}
+	for _, id := range ids {
+		rac.Accounts = append(rac.Accounts, suggestedAccount(id).ToRawAccount())
 	}
 
 	return common.JsonResponseWithoutChunking(c, http.StatusOK, &rac)
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+)
+
+type AccountTopParam struct {
+	limit   int
+	sex     int8
+	status  int8
+	city    string
+	country string
+	// likes with ts in [tsFrom, tsTo] are counted when windowed
+	tsFrom, tsTo int
+	windowed     bool
+}
+
+type AccountTopFunc func(param string, atp *AccountTopParam) error
+
+func limitTopParser(param string, atp *AccountTopParam) error {
+	limit, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("failed to parse limit (%s)", param)
+	}
+	if limit <= 0 {
+		return fmt.Errorf("limit should be positive (%s)", param)
+	}
+	atp.limit = limit
+	return nil
+}
+
+func sexTopParser(param string, atp *AccountTopParam) error {
+	atp.sex = common.SexFromString(param)
+	if atp.sex == 0 {
+		return fmt.Errorf("%s is not valid sex", param)
+	}
+	return nil
+}
+
+func statusTopParser(param string, atp *AccountTopParam) error {
+	atp.status = common.StatusFromString(param)
+	if atp.status == 0 {
+		return fmt.Errorf("%s is not valid status", param)
+	}
+	return nil
+}
+
+func cityTopParser(param string, atp *AccountTopParam) error {
+	atp.city = param
+	return nil
+}
+
+func countryTopParser(param string, atp *AccountTopParam) error {
+	atp.country = param
+	return nil
+}
+
+func tsFromTopParser(param string, atp *AccountTopParam) error {
+	ts, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("failed to parse ts_from (%s)", param)
+	}
+	atp.tsFrom = ts
+	atp.windowed = true
+	return nil
+}
+
+func tsToTopParser(param string, atp *AccountTopParam) error {
+	ts, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("failed to parse ts_to (%s)", param)
+	}
+	atp.tsTo = ts
+	atp.windowed = true
+	return nil
+}
+
+var accountTopFuncs = map[string]AccountTopFunc{
+	"limit":    limitTopParser,
+	"sex":      sexTopParser,
+	"status":   statusTopParser,
+	"city":     cityTopParser,
+	"country":  countryTopParser,
+	"ts_from":  tsFromTopParser,
+	"ts_to":    tsToTopParser,
+	"query_id": func(param string, atp *AccountTopParam) error { return nil },
+}
+
+func accountsTopParser(queryParams url.Values) (*AccountTopParam, error) {
+	atp := &AccountTopParam{limit: -1, tsTo: math.MaxInt32}
+	for field, param := range queryParams {
+		if param[0] == "" {
+			return nil, fmt.Errorf("parameter cannot be empty (field = %s)", field)
+		}
+		fun, found := accountTopFuncs[field]
+		if !found {
+			return nil, fmt.Errorf("filter (%s) not found", field)
+		}
+		if len(param) != 1 {
+			return nil, fmt.Errorf("multiple params in filter (%s)", field)
+		}
+		if err := fun(param[0], atp); err != nil {
+			return nil, err
+		}
+	}
+	if atp.limit == -1 {
+		return nil, fmt.Errorf("limit is not specified")
+	}
+	if atp.tsFrom > atp.tsTo {
+		return nil, fmt.Errorf("ts_from is larger than ts_to (%d > %d)", atp.tsFrom, atp.tsTo)
+	}
+	return atp, nil
+}
+
+type RawTopAccount struct {
+	*common.RawAccount
+	Likers int `json:"likers"`
+}
+
+type RawTopAccountsContainer struct {
+	Accounts []*RawTopAccount `json:"accounts"`
+}
+
+type topEntry struct {
+	id, likers int
+}
+
+// topEntries visits accounts in the maintained order of received likes.
+// with a time window, the total count bounds the count in the window, so the walk stops when the total
+// becomes smaller than the last of the current top.
+func topEntries(atp *AccountTopParam) []topEntry {
+	countryId, cityId := 0, 0
+	if atp.country != "" {
+		countryId = globals.As.GetCountryId(atp.country)
+	}
+	if atp.city != "" {
+		cityId = globals.As.GetCityId(atp.city)
+	}
+
+	var top []topEntry
+	globals.Ls.WalkByLikersCount(func(id, count int) bool {
+		if len(top) == atp.limit && count < top[len(top)-1].likers {
+			return false
+		}
+		a := globals.As.GetStoredAccountWithoutError(id)
+		if a == nil {
+			return true
+		}
+		if atp.sex != 0 && a.Sex != atp.sex {
+			return true
+		}
+		if atp.status != 0 && a.Status != atp.status {
+			return true
+		}
+		if countryId != 0 && a.Country != countryId {
+			return true
+		}
+		if cityId != 0 && a.City != cityId {
+			return true
+		}
+
+		if !atp.windowed {
+			top = append(top, topEntry{id, count})
+			return len(top) < atp.limit
+		}
+		likers := globals.Ls.LikersCountBetween(id, atp.tsFrom, atp.tsTo)
+		if likers == 0 {
+			return true
+		}
+		// ids are visited in descending order within the same total count, but not across them
+		i := sort.Search(len(top), func(i int) bool {
+			if top[i].likers != likers {
+				return top[i].likers < likers
+			}
+			return top[i].id < id
+		})
+		if i == atp.limit {
+			return true
+		}
+		top = append(top, topEntry{})
+		copy(top[i+1:], top[i:])
+		top[i] = topEntry{id, likers}
+		if len(top) > atp.limit {
+			top = top[:atp.limit]
+		}
+		return true
+	})
+	return top
+}
+
+// profileAccount is the public part of an account returned by top and similar.
+func profileAccount(id int) *common.Account {
+	a := globals.As.GetStoredAccountWithoutError(id)
+	return &common.Account{
+		ID:      a.ID,
+		Email:   a.Email,
+		Fname:   a.Fname,
+		Sname:   a.Sname,
+		Status:  a.Status,
+		Sex:     a.Sex,
+		City:    globals.As.IdToCity(a.City),
+		Country: globals.As.IdToCountry(a.Country),
+	}
+}
+
+func AccountsTopCore(queryParams url.Values) (*RawTopAccountsContainer, *HlcHttpError) {
+	atp, err := accountsTopParser(queryParams)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+
+	ret := &RawTopAccountsContainer{[]*RawTopAccount{}}
+	for _, e := range topEntries(atp) {
+		ret.Accounts = append(ret.Accounts, &RawTopAccount{profileAccount(e.id).ToRawAccount(), e.likers})
+	}
+	return ret, nil
+}
+
+func AccountsTopHandler(c echo.Context) error {
+	ret, err := AccountsTopCore(c.QueryParams())
+	if err != nil {
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
@@ -31,6 +31,11 @@ func AccountsUpdateHandlerCore(idStr string, j []byte) *HlcHttpError {
 	if err != nil {
 		return &HlcHttpError{http.StatusBadRequest, err}
 	}
+	if ra.Email != "" {
+		if err := common.ValidateEmail(ra.Email); err != nil {
+			return &HlcHttpError{http.StatusBadRequest, err}
+		}
+	}
 
 	if _, err := globals.As.GetStoredAccount(id); err != nil {
 		return &HlcHttpError{http.StatusNotFound, fmt.Errorf("account not found")}
@@ -45,6 +50,8 @@ func AccountsUpdateHandlerCore(idStr string, j []byte) *HlcHttpError {
 			return &HlcHttpError{http.StatusBadRequest, err}
 		}
 	}
+	globals.Ri.Reindex(a.ID)
+	globals.Ps.Schedule(a.ID, common.Now())
 
 	return nil
 }
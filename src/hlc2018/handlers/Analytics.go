@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/analytics"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type RawAnalyticsStatus struct {
+	Running      bool  `json:"running"`
+	Computed     bool  `json:"computed"`
+	ComputedAt   int64 `json:"computed_at,omitempty"`
+	ElapsedNanos int64 `json:"elapsed_nanos,omitempty"`
+	Components   int   `json:"components,omitempty"`
+	Communities  int   `json:"communities,omitempty"`
+}
+
+type RawAccountAnalytics struct {
+	ID            int     `json:"id"`
+	PageRank      float64 `json:"pagerank"`
+	Reciprocity   float64 `json:"reciprocity"`
+	Component     int     `json:"component"`
+	ComponentSize int     `json:"component_size"`
+	Community     int     `json:"community"`
+	CommunitySize int     `json:"community_size"`
+}
+
+type RawAnalyticsAccounts struct {
+	Accounts []*RawAccountAnalytics `json:"accounts"`
+}
+
+type RawAnalyticsGroup struct {
+	ID   int `json:"id"`
+	Size int `json:"size"`
+}
+
+type RawAnalyticsGroups struct {
+	Groups []*RawAnalyticsGroup `json:"groups"`
+}
+
+func AnalyticsStatusCore() *RawAnalyticsStatus {
+	s := &RawAnalyticsStatus{Running: globals.Ga.Running()}
+	if r := globals.Ga.Result(); r != nil {
+		s.Computed = true
+		s.ComputedAt = r.ComputedAt.Unix()
+		s.ElapsedNanos = r.Elapsed.Nanoseconds()
+		s.Components = len(r.ComponentSize)
+		s.Communities = len(r.CommunitySize)
+	}
+	return s
+}
+
+func accountAnalytics(r *analytics.Result, id int) *RawAccountAnalytics {
+	return &RawAccountAnalytics{
+		ID:            id,
+		PageRank:      r.PageRank[id],
+		Reciprocity:   r.Reciprocity[id],
+		Component:     r.Component[id],
+		ComponentSize: r.ComponentSize[r.Component[id]],
+		Community:     r.Community[id],
+		CommunitySize: r.CommunitySize[r.Community[id]],
+	}
+}
+
+// computedResult returns the latest result or 503 while the first computation is not finished.
+func computedResult() (*analytics.Result, *HlcHttpError) {
+	r := globals.Ga.Result()
+	if r == nil {
+		return nil, &HlcHttpError{http.StatusServiceUnavailable, fmt.Errorf("analytics is not computed yet")}
+	}
+	return r, nil
+}
+
+func analyticsLimit(queryParams url.Values) (int, error) {
+	limit := 20
+	for field, param := range queryParams {
+		switch field {
+		case "limit":
+			l, err := strconv.Atoi(param[0])
+			if err != nil || l <= 0 {
+				return 0, fmt.Errorf("limit should be positive (%s)", param[0])
+			}
+			limit = l
+		case "query_id":
+		default:
+			return 0, fmt.Errorf("filter (%s) not found", field)
+		}
+	}
+	return limit, nil
+}
+
+func AnalyticsAccountCore(idStr string) (*RawAccountAnalytics, *HlcHttpError) {
+	r, herr := computedResult()
+	if herr != nil {
+		return nil, herr
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		return nil, &HlcHttpError{http.StatusNotFound, err}
+	}
+	// accounts inserted after the computation are not in the result
+	if id < 0 || id >= len(r.PageRank) || globals.As.GetStoredAccountWithoutError(id) == nil {
+		return nil, &HlcHttpError{http.StatusNotFound, fmt.Errorf("account (%d) not found in analytics", id)}
+	}
+	return accountAnalytics(r, id), nil
+}
+
+func AnalyticsPageRankCore(queryParams url.Values) (*RawAnalyticsAccounts, *HlcHttpError) {
+	limit, err := analyticsLimit(queryParams)
+	if err != nil {
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	r, herr := computedResult()
+	if herr != nil {
+		return nil, herr
+	}
+	ret := &RawAnalyticsAccounts{[]*RawAccountAnalytics{}}
+	for _, id := range r.TopPageRank(limit) {
+		ret.Accounts = append(ret.Accounts, accountAnalytics(r, id))
+	}
+	return ret, nil
+}
+
+func analyticsGroupsCore(queryParams url.Values, sizes func(r *analytics.Result) map[int]int) (*RawAnalyticsGroups, *HlcHttpError) {
+	limit, err := analyticsLimit(queryParams)
+	if err != nil {
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	r, herr := computedResult()
+	if herr != nil {
+		return nil, herr
+	}
+	ret := &RawAnalyticsGroups{[]*RawAnalyticsGroup{}}
+	for _, l := range analytics.LargestGroups(sizes(r), limit) {
+		ret.Groups = append(ret.Groups, &RawAnalyticsGroup{l, sizes(r)[l]})
+	}
+	return ret, nil
+}
+
+func AnalyticsStatusHandler(c echo.Context) error {
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, AnalyticsStatusCore())
+}
+
+func AnalyticsRunHandler(c echo.Context) error {
+	if !globals.Ga.Run() {
+		return c.String(http.StatusConflict, "")
+	}
+	return c.JSON(http.StatusAccepted, map[string]struct{}{})
+}
+
+func AnalyticsAccountHandler(c echo.Context) error {
+	ret, err := AnalyticsAccountCore(c.Param("id"))
+	if err != nil {
+		log.Print(err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
+
+func AnalyticsPageRankHandler(c echo.Context) error {
+	ret, err := AnalyticsPageRankCore(c.QueryParams())
+	if err != nil {
+		log.Print(err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
+
+func AnalyticsComponentsHandler(c echo.Context) error {
+	ret, err := analyticsGroupsCore(c.QueryParams(), func(r *analytics.Result) map[int]int { return r.ComponentSize })
+	if err != nil {
+		log.Print(err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
+
+func AnalyticsCommunitiesHandler(c echo.Context) error {
+	ret, err := analyticsGroupsCore(c.QueryParams(), func(r *analytics.Result) map[int]int { return r.CommunitySize })
+	if err != nil {
+		log.Print(err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"hlc2018/common"
+	"hlc2018/globals"
+	"hlc2018/store"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	coldStartCity    = "city"
+	coldStartCountry = "country"
+	coldStartGlobal  = "global"
+)
+
+// ColdStartFallbacks is the chain of levels tried in order when recommend is requested for an account without
+// interests or suggest for an account without likes. it is empty by default and set by COLD_START_FALLBACK
+// like "city,country,global".
+var ColdStartFallbacks []string
+
+// RawAccountsContainerWithFallback is the response of recommend and suggest. Fallback is the level of
+// the cold-start fallback which produced the accounts, if any.
+type RawAccountsContainerWithFallback struct {
+	Accounts []*common.RawAccount `json:"accounts"`
+	Fallback string               `json:"fallback,omitempty"`
+}
+
+type RawColdStartExplain struct {
+	Fallback string `json:"fallback"`
+	Likers   int    `json:"likers"`
+}
+
+func explainColdStart(fallback string, id int) *RawColdStartExplain {
+	return &RawColdStartExplain{fallback, globals.Ls.LikersCount(id)}
+}
+
+func inColdStartLevel(level string, me, a *store.StoredAccount) bool {
+	switch level {
+	case coldStartCity:
+		return me.City != 0 && me.City == a.City
+	case coldStartCountry:
+		return me.Country != 0 && me.Country == a.Country
+	}
+	return true
+}
+
+// coldStartIds returns the most liked accounts passing isCandidate at the first level of ColdStartFallbacks
+// which has any of them, and the level.
+func coldStartIds(me *store.StoredAccount, limit int, isCandidate func(a *store.StoredAccount) bool) ([]int, string) {
+	for _, level := range ColdStartFallbacks {
+		ids := globals.Ls.MostLiked(func(id int) bool {
+			a := globals.As.GetStoredAccountWithoutError(id)
+			return a != nil && isCandidate(a) && inColdStartLevel(level, me, a)
+		}, limit)
+		if len(ids) > 0 {
+			return ids, level
+		}
+	}
+	return nil, ""
+}
+
+func init() {
+	fallbacks := os.Getenv("COLD_START_FALLBACK")
+	if fallbacks == "" {
+		return
+	}
+	for _, level := range strings.Split(fallbacks, ",") {
+		if level != coldStartCity && level != coldStartCountry && level != coldStartGlobal {
+			log.Fatalf("cold start fallback (%s) not found", level)
+		}
+		ColdStartFallbacks = append(ColdStartFallbacks, level)
+	}
+}
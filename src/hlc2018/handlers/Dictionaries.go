@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"log"
+	"net/http"
+	"sort"
+)
+
+type RawNameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type RawCountries struct {
+	Countries []*RawNameCount `json:"countries"`
+}
+
+type RawCities struct {
+	Country string          `json:"country"`
+	Cities  []*RawNameCount `json:"cities"`
+}
+
+// sortedNameCounts converts counts per string id in descending order of count and then name.
+func sortedNameCounts(counts map[int]int, idToString func(id int) string) []*RawNameCount {
+	ret := []*RawNameCount{}
+	for id, cnt := range counts {
+		ret = append(ret, &RawNameCount{idToString(id), cnt})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func CountriesCore() *RawCountries {
+	return &RawCountries{sortedNameCounts(globals.As.CountryCounts(), globals.As.IdToCountry)}
+}
+
+func CitiesCore(country string) (*RawCities, *HlcHttpError) {
+	countryId := globals.As.GetCountryId(country)
+	if countryId <= 0 {
+		return nil, &HlcHttpError{http.StatusNotFound, fmt.Errorf("country (%s) not found", country)}
+	}
+	return &RawCities{country, sortedNameCounts(globals.As.CityCountsInCountry(countryId), globals.As.IdToCity)}, nil
+}
+
+func CountriesHandler(c echo.Context) error {
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, CountriesCore())
+}
+
+func CitiesHandler(c echo.Context) error {
+	country, uerr := unescapedParam(c, "name")
+	if uerr != nil {
+		log.Print(uerr)
+		return c.String(http.StatusBadRequest, "")
+	}
+	ret, err := CitiesCore(country)
+	if err != nil {
+		log.Print(err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"hlc2018/store"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// groups of accounts sharing a key larger than this are not reported as duplicates
+const maxDuplicateGroup = 20
+
+type RawDuplicatePair struct {
+	Ids     [2]int   `json:"ids"`
+	Reasons []string `json:"reasons"`
+}
+
+type RawDuplicatesReport struct {
+	ComputedAt int64               `json:"computed_at"`
+	Pairs      []*RawDuplicatePair `json:"pairs"`
+}
+
+type RawMergeRequest struct {
+	Into *int `json:"into"`
+	From *int `json:"from"`
+}
+
+type duplicatesReport struct {
+	mu         sync.RWMutex
+	pairs      []*store.DuplicatePair
+	computedAt time.Time
+}
+
+var duplicates duplicatesReport
+
+// run detects the duplicates in the request like the other handlers reading the stores,
+// since the stores are written by the handlers without locks.
+func (dr *duplicatesReport) run() {
+	pairs := globals.As.FindDuplicates(maxDuplicateGroup)
+	dr.mu.Lock()
+	defer dr.mu.Unlock()
+	dr.pairs = pairs
+	dr.computedAt = time.Now()
+}
+
+func duplicatesLimit(queryParams url.Values) (int, error) {
+	limit := -1
+	for field, param := range queryParams {
+		switch field {
+		case "limit":
+			l, err := strconv.Atoi(param[0])
+			if err != nil || l <= 0 {
+				return 0, fmt.Errorf("limit should be positive (%s)", param[0])
+			}
+			limit = l
+		case "query_id":
+		default:
+			return 0, fmt.Errorf("filter (%s) not found", field)
+		}
+	}
+	return limit, nil
+}
+
+// DuplicatesReportCore returns the latest report. pairs including accounts merged since then are skipped.
+func DuplicatesReportCore(queryParams url.Values) (*RawDuplicatesReport, *HlcHttpError) {
+	limit, err := duplicatesLimit(queryParams)
+	if err != nil {
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	duplicates.mu.RLock()
+	defer duplicates.mu.RUnlock()
+	if duplicates.computedAt.IsZero() {
+		return nil, &HlcHttpError{http.StatusServiceUnavailable, fmt.Errorf("duplicates are not detected yet")}
+	}
+
+	ret := &RawDuplicatesReport{duplicates.computedAt.Unix(), []*RawDuplicatePair{}}
+	for _, p := range duplicates.pairs {
+		if limit != -1 && len(ret.Pairs) == limit {
+			break
+		}
+		if globals.As.GetStoredAccountWithoutError(p.Ids[0]) == nil || globals.As.GetStoredAccountWithoutError(p.Ids[1]) == nil {
+			continue
+		}
+		ret.Pairs = append(ret.Pairs, &RawDuplicatePair{p.Ids, p.Reasons})
+	}
+	return ret, nil
+}
+
+// MergeAccountsCore moves the interests, likes, passes and blocks of from to into and deletes from.
+// the fields of into are kept as they are.
+func MergeAccountsCore(j []byte) *HlcHttpError {
+	var rmr RawMergeRequest
+	if err := json.Unmarshal(j, &rmr); err != nil {
+		return &HlcHttpError{http.StatusBadRequest, err}
+	}
+	if rmr.Into == nil || rmr.From == nil {
+		return &HlcHttpError{http.StatusBadRequest, fmt.Errorf("into and from are required")}
+	}
+	into, from := *rmr.Into, *rmr.From
+	if into == from {
+		return &HlcHttpError{http.StatusBadRequest, fmt.Errorf("%d cannot be merged into itself", from)}
+	}
+	for _, id := range []int{into, from} {
+		if _, err := globals.As.GetStoredAccount(id); err != nil {
+			return &HlcHttpError{http.StatusNotFound, fmt.Errorf("account (%d) not found", id)}
+		}
+	}
+
+	globals.Is.MoveInterests(from, into)
+	globals.Ls.MoveLikes(from, into)
+	globals.Bs.MoveBlocks(from, into)
+	if err := globals.As.DeleteAccount(from); err != nil {
+		return &HlcHttpError{http.StatusNotFound, err}
+	}
+	globals.Ri.Reindex(into)
+	globals.Ri.Reindex(from)
+	return nil
+}
+
+// DuplicatesRunHandler detects the duplicates and responds the new report like DuplicatesReportHandler.
+func DuplicatesRunHandler(c echo.Context) error {
+	if _, err := duplicatesLimit(c.QueryParams()); err != nil {
+		log.Print(err)
+		return c.String(http.StatusBadRequest, "")
+	}
+	duplicates.run()
+	return DuplicatesReportHandler(c)
+}
+
+func DuplicatesReportHandler(c echo.Context) error {
+	ret, err := DuplicatesReportCore(c.QueryParams())
+	if err != nil {
+		log.Print(err.Err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
+
+func DuplicatesMergeHandler(c echo.Context) error {
+	j, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.String(http.StatusBadRequest, "")
+	}
+	if herr := MergeAccountsCore(j); herr != nil {
+		log.Print(herr.Err)
+		return c.String(herr.HttpStatusCode, "")
+	}
+	return c.JSON(http.StatusAccepted, map[string]struct{}{})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type InterestsParam struct {
+	// restrictions on accounts, parsed by the same functions as group
+	agp      *AccountGroupParam
+	filtered bool
+	limit    int
+	prefix   string
+	metric   string
+	minCount int
+}
+
+type InterestsFunc func(param string, ip *InterestsParam) error
+
+// group params usable as restrictions on accounts
+var interestsGroupFilterFields = []string{"sex", "country", "city"}
+
+func limitInterestsParser(param string, ip *InterestsParam) error {
+	limit, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("failed to parse limit (%s)", param)
+	}
+	if limit <= 0 {
+		return fmt.Errorf("limit should be positive (%s)", param)
+	}
+	ip.limit = limit
+	return nil
+}
+
+func prefixInterestsParser(param string, ip *InterestsParam) error {
+	ip.prefix = param
+	return nil
+}
+
+const (
+	interestMetricLift = "lift"
+	interestMetricPMI  = "pmi"
+	// PMI normalized into [-1, 1] by -log P(a, b)
+	interestMetricNPMI = "npmi"
+)
+
+func metricInterestsParser(param string, ip *InterestsParam) error {
+	if param != interestMetricLift && param != interestMetricPMI && param != interestMetricNPMI {
+		return fmt.Errorf("metric (%s) not found", param)
+	}
+	ip.metric = param
+	return nil
+}
+
+func minCountInterestsParser(param string, ip *InterestsParam) error {
+	minCount, err := strconv.Atoi(param)
+	if err != nil {
+		return fmt.Errorf("failed to parse min_count (%s)", param)
+	}
+	if minCount <= 0 {
+		return fmt.Errorf("min_count should be positive (%s)", param)
+	}
+	ip.minCount = minCount
+	return nil
+}
+
+var interestsFuncs = map[string]InterestsFunc{
+	"limit":    limitInterestsParser,
+	"prefix":   prefixInterestsParser,
+	"query_id": func(param string, ip *InterestsParam) error { return nil },
+}
+
+var relatedInterestsFuncs = map[string]InterestsFunc{
+	"limit":     limitInterestsParser,
+	"metric":    metricInterestsParser,
+	"min_count": minCountInterestsParser,
+	"query_id":  func(param string, ip *InterestsParam) error { return nil },
+}
+
+func init() {
+	for _, field := range interestsGroupFilterFields {
+		groupFunc := accountGroupFuncs[field]
+		fun := func(param string, ip *InterestsParam) error {
+			ip.filtered = true
+			return groupFunc(param, ip.agp)
+		}
+		interestsFuncs[field] = fun
+		relatedInterestsFuncs[field] = fun
+	}
+}
+
+func interestsParser(queryParams url.Values, funcs map[string]InterestsFunc) (*InterestsParam, error) {
+	ip := &InterestsParam{
+		agp:      &AccountGroupParam{keys: map[string]struct{}{}, limit: -1, countGt: -1, countLt: -1},
+		limit:    -1,
+		metric:   interestMetricLift,
+		minCount: 1,
+	}
+	for field, param := range queryParams {
+		if param[0] == "" {
+			return nil, fmt.Errorf("parameter cannot be empty (field = %s)", field)
+		}
+		fun, found := funcs[field]
+		if !found {
+			return nil, fmt.Errorf("filter (%s) not found", field)
+		}
+		if len(param) != 1 {
+			return nil, fmt.Errorf("multiple params in filter (%s)", field)
+		}
+		if err := fun(param[0], ip); err != nil {
+			return nil, err
+		}
+	}
+	return ip, nil
+}
+
+func (ip *InterestsParam) accountFilter() func(id int) bool {
+	if !ip.filtered {
+		return func(id int) bool { return true }
+	}
+	return GenFilterFromAccountsGroupParams(ip.agp)
+}
+
+type RawInterestCount struct {
+	Interest string `json:"interest"`
+	Count    int    `json:"count"`
+}
+
+type RawInterestCounts struct {
+	Interests []*RawInterestCount `json:"interests"`
+}
+
+type RawRelatedInterest struct {
+	Interest string  `json:"interest"`
+	Count    int     `json:"count"`
+	Lift     float64 `json:"lift"`
+	PMI      float64 `json:"pmi"`
+	NPMI     float64 `json:"npmi"`
+}
+
+type RawRelatedInterests struct {
+	Interest  string                `json:"interest"`
+	Count     int                   `json:"count"`
+	Interests []*RawRelatedInterest `json:"interests"`
+}
+
+// InterestsCore lists interests starting with prefix in descending order of the number of accounts.
+func InterestsCore(queryParams url.Values) (*RawInterestCounts, *HlcHttpError) {
+	ip, err := interestsParser(queryParams, interestsFuncs)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+
+	ret := &RawInterestCounts{[]*RawInterestCount{}}
+	for interestId, cnt := range globals.Is.CountInterests(ip.accountFilter()) {
+		interest := globals.Is.InterestIdToString(interestId)
+		if !strings.HasPrefix(interest, ip.prefix) {
+			continue
+		}
+		ret.Interests = append(ret.Interests, &RawInterestCount{interest, cnt})
+	}
+	sort.Slice(ret.Interests, func(i, j int) bool {
+		l, r := ret.Interests[i], ret.Interests[j]
+		if l.Count != r.Count {
+			return l.Count > r.Count
+		}
+		return l.Interest < r.Interest
+	})
+	if ip.limit != -1 && len(ret.Interests) > ip.limit {
+		ret.Interests = ret.Interests[:ip.limit]
+	}
+	return ret, nil
+}
+
+func (ri *RawRelatedInterest) score(metric string) float64 {
+	switch metric {
+	case interestMetricPMI:
+		return ri.PMI
+	case interestMetricNPMI:
+		return ri.NPMI
+	}
+	return ri.Lift
+}
+
+// RelatedInterestsCore ranks interests co-occurring with name among the accounts passing the restrictions.
+func RelatedInterestsCore(name string, queryParams url.Values) (*RawRelatedInterests, *HlcHttpError) {
+	ip, err := interestsParser(queryParams, relatedInterestsFuncs)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	interestId := globals.Is.GetInterestId(name)
+	if interestId <= 0 {
+		return nil, &HlcHttpError{http.StatusNotFound, fmt.Errorf("interest (%s) not found", name)}
+	}
+
+	filter := ip.accountFilter()
+	counts := globals.Is.CountInterests(filter)
+	total := float64(globals.Is.CountAccountsWithInterests(filter))
+	ret := &RawRelatedInterests{name, counts[interestId], []*RawRelatedInterest{}}
+	for other, co := range globals.Is.CoOccurrences(interestId, filter) {
+		if co < ip.minCount {
+			continue
+		}
+		lift := float64(co) * total / float64(counts[interestId]) / float64(counts[other])
+		pmi := math.Log(lift)
+		npmi := 1.0
+		if co < int(total) {
+			npmi = pmi / -math.Log(float64(co)/total)
+		}
+		ret.Interests = append(ret.Interests, &RawRelatedInterest{
+			globals.Is.InterestIdToString(other), co, lift, pmi, npmi,
+		})
+	}
+	sort.Slice(ret.Interests, func(i, j int) bool {
+		l, r := ret.Interests[i], ret.Interests[j]
+		x, y := l.score(ip.metric), r.score(ip.metric)
+		if x != y {
+			return x > y
+		}
+		if l.Count != r.Count {
+			return l.Count > r.Count
+		}
+		return l.Interest < r.Interest
+	})
+	if ip.limit != -1 && len(ret.Interests) > ip.limit {
+		ret.Interests = ret.Interests[:ip.limit]
+	}
+	return ret, nil
+}
+
+func InterestsHandler(c echo.Context) error {
+	ret, err := InterestsCore(c.QueryParams())
+	if err != nil {
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
+
+func RelatedInterestsHandler(c echo.Context) error {
+	name, uerr := unescapedParam(c, "name")
+	if uerr != nil {
+		log.Print(uerr)
+		return c.String(http.StatusBadRequest, "")
+	}
+	ret, err := RelatedInterestsCore(name, c.QueryParams())
+	if err != nil {
+		log.Print(err)
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
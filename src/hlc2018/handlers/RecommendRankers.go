@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"hlc2018/store"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type RecommendCandidate struct {
+	*store.StoredAccount
+	// the number of interests shared with the account which recommend is requested for
+	CommonInterests int
+}
+
+// Ranker decides the order of /accounts/:id/recommend/.
+type Ranker interface {
+	// Rank sorts candidates for me in place. the first one is recommended most.
+	Rank(me *store.StoredAccount, candidates []RecommendCandidate)
+}
+
+// defaultRanker is the order required by HLC:
+// premium_now, status (free, complicated, taken), common interests and birth distance.
+type defaultRanker struct{}
+
+func (defaultRanker) Rank(me *store.StoredAccount, acs []RecommendCandidate) {
+	sort.Slice(acs, func(i, j int) bool {
+		if acs[i].Premium_now != acs[j].Premium_now {
+			return acs[i].Premium_now
+		}
+		c, d := common.StatusRecommendOrder(acs[i].Status), common.StatusRecommendOrder(acs[j].Status)
+		if c != d {
+			return c < d
+		}
+		x := acs[i].CommonInterests
+		y := acs[j].CommonInterests
+		if x != y {
+			return x > y
+		}
+		a := common.AbsInt(me.Birth - acs[i].Birth)
+		b := common.AbsInt(me.Birth - acs[j].Birth)
+		return a < b
+	})
+}
+
+// weightedRanker sorts by a linear combination of the same signals as defaultRanker.
+type weightedRanker struct {
+	weights map[string]float64
+}
+
+var defaultRecommendWeights = map[string]float64{
+	"premium":   10,
+	"status":    3,
+	"interests": 1,
+	// per year
+	"birth": 0.05,
+	// per the average PageRank from the graph analytics
+	"pagerank": 0,
+	// per 100 km between cities. unknown distances are not penalized
+	"distance": 0,
+}
+
+func (wr *weightedRanker) score(me *store.StoredAccount, c *RecommendCandidate) float64 {
+	score := 0.0
+	if c.Premium_now {
+		score += wr.weights["premium"]
+	}
+	score += wr.weights["status"] * float64(2-common.StatusRecommendOrder(c.Status)) / 2
+	score += wr.weights["interests"] * float64(c.CommonInterests)
+	score -= wr.weights["birth"] * float64(common.AbsInt(me.Birth-c.Birth)) / secondsPerYear
+	if w := wr.weights["pagerank"]; w != 0 {
+		score += w * globals.Ga.PageRank(c.ID)
+	}
+	if w := wr.weights["distance"]; w != 0 {
+		if d, ok := accountDistanceKm(me, c.StoredAccount); ok {
+			score -= w * d / 100
+		}
+	}
+	return score
+}
+
+func (wr *weightedRanker) Rank(me *store.StoredAccount, acs []RecommendCandidate) {
+	scores := map[int]float64{}
+	for i := range acs {
+		scores[acs[i].ID] = wr.score(me, &acs[i])
+	}
+	sort.Slice(acs, func(i, j int) bool {
+		x, y := scores[acs[i].ID], scores[acs[j].ID]
+		if x != y {
+			return x > y
+		}
+		return acs[i].ID > acs[j].ID
+	})
+}
+
+// idfRanker works as defaultRanker but shared rare interests count more than popular ones.
+type idfRanker struct{}
+
+func idfInterestOverlap(id, otherId int) float64 {
+	sum := 0.0
+	for _, interestId := range globals.Is.CommonInterestIds(id, otherId) {
+		sum += globals.Is.InterestIdf(interestId)
+	}
+	return sum
+}
+
+func (idfRanker) Rank(me *store.StoredAccount, acs []RecommendCandidate) {
+	overlaps := map[int]float64{}
+	for i := range acs {
+		overlaps[acs[i].ID] = idfInterestOverlap(me.ID, acs[i].ID)
+	}
+	sort.Slice(acs, func(i, j int) bool {
+		if acs[i].Premium_now != acs[j].Premium_now {
+			return acs[i].Premium_now
+		}
+		c, d := common.StatusRecommendOrder(acs[i].Status), common.StatusRecommendOrder(acs[j].Status)
+		if c != d {
+			return c < d
+		}
+		x, y := overlaps[acs[i].ID], overlaps[acs[j].ID]
+		if x != y {
+			return x > y
+		}
+		a := common.AbsInt(me.Birth - acs[i].Birth)
+		b := common.AbsInt(me.Birth - acs[j].Birth)
+		return a < b
+	})
+}
+
+var recommendRankers = map[string]Ranker{
+	"default":  defaultRanker{},
+	"weighted": &weightedRanker{defaultRecommendWeights},
+	"idf":      idfRanker{},
+}
+
+// DefaultRecommendRanker is used when the ranker param is not given. it can be changed by RECOMMEND_RANKER.
+var DefaultRecommendRanker = "default"
+
+// parseRecommendWeights parses "premium=10,status=3,..." and overwrites the default weights.
+func parseRecommendWeights(s string) (map[string]float64, error) {
+	ret := map[string]float64{}
+	for k, v := range defaultRecommendWeights {
+		ret[k] = v
+	}
+	for _, kv := range strings.Split(s, ",") {
+		tmp := strings.Split(kv, "=")
+		if len(tmp) != 2 {
+			return nil, fmt.Errorf("invalid weight (%s)", kv)
+		}
+		if _, found := ret[tmp[0]]; !found {
+			return nil, fmt.Errorf("weight (%s) not found", tmp[0])
+		}
+		w, err := strconv.ParseFloat(tmp[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse weight (%s)", kv)
+		}
+		ret[tmp[0]] = w
+	}
+	return ret, nil
+}
+
+func init() {
+	if weights := os.Getenv("RECOMMEND_WEIGHTS"); weights != "" {
+		parsed, err := parseRecommendWeights(weights)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recommendRankers["weighted"] = &weightedRanker{parsed}
+	}
+	if ranker := os.Getenv("RECOMMEND_RANKER"); ranker != "" {
+		if _, found := recommendRankers[ranker]; !found {
+			log.Fatalf("ranker (%s) not found", ranker)
+		}
+		DefaultRecommendRanker = ranker
+	}
+}
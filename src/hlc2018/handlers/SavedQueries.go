@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"hlc2018/common"
+	"hlc2018/globals"
+	"hlc2018/store"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RawSavedQuery is a template of /accounts/filter/ or /accounts/group/.
+// Values of Params can contain placeholders like "{city}" which are declared in Placeholders with their types.
+type RawSavedQuery struct {
+	Name         string            `json:"name"`
+	Endpoint     string            `json:"endpoint"`
+	Params       map[string]string `json:"params"`
+	Placeholders map[string]string `json:"placeholders"`
+}
+
+type RawSavedQueryStats struct {
+	Executions  int   `json:"executions"`
+	Errors      int   `json:"errors"`
+	Rows        int   `json:"rows"`
+	TotalNanos  int64 `json:"total_nanos"`
+	MaxNanos    int64 `json:"max_nanos"`
+	LastNanos   int64 `json:"last_nanos"`
+	IndexCached bool  `json:"index_cached"`
+}
+
+type RawSavedQueryWithStats struct {
+	RawSavedQuery
+	Stats RawSavedQueryStats `json:"stats"`
+}
+
+type RawSavedQueries struct {
+	Queries []*RawSavedQueryWithStats `json:"queries"`
+}
+
+const (
+	savedQueryFilter = "filter"
+	savedQueryGroup  = "group"
+)
+
+// sample values are used to validate a template at registration
+var placeholderSamples = map[string]string{
+	"string": "a",
+	"int":    "1",
+	"sex":    common.SEXES[0],
+	"status": common.STATUSES[0],
+}
+
+// params deciding the store source. if they don't contain placeholders, the ids from the index can be reused
+var savedQueryIndexParams = map[string][]string{
+	savedQueryFilter: {"likes_contains", "interests_contains", "interests_any"},
+	savedQueryGroup:  {"likes", "interests"},
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+type savedQuery struct {
+	RawSavedQuery
+	indexCacheable bool
+
+	mu            sync.Mutex
+	stats         RawSavedQueryStats
+	cached        bool
+	cachedVersion int
+	cachedIds     []int
+	cachedIndexed bool
+}
+
+var savedQueriesMu sync.RWMutex
+var savedQueries = map[string]*savedQuery{}
+
+func validatePlaceholderValue(typ, value string) error {
+	switch typ {
+	case "int":
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("failed to parse int (%s)", value)
+		}
+	case "sex":
+		if common.SexFromString(value) == 0 {
+			return fmt.Errorf("%s is not valid sex", value)
+		}
+	case "status":
+		if common.StatusFromString(value) == 0 {
+			return fmt.Errorf("%s is not valid status", value)
+		}
+	}
+	return nil
+}
+
+func (sq *savedQuery) bind(values map[string]string) url.Values {
+	ret := url.Values{}
+	for field, param := range sq.Params {
+		ret.Set(field, placeholderRegexp.ReplaceAllStringFunc(param, func(s string) string {
+			return values[s[1:len(s)-1]]
+		}))
+	}
+	return ret
+}
+
+func newSavedQuery(raw *RawSavedQuery) (*savedQuery, error) {
+	if raw.Name == "" {
+		return nil, fmt.Errorf("name is empty")
+	}
+	indexParams, found := savedQueryIndexParams[raw.Endpoint]
+	if !found {
+		return nil, fmt.Errorf("invalid endpoint (%s)", raw.Endpoint)
+	}
+
+	samples := map[string]string{}
+	for name, typ := range raw.Placeholders {
+		sample, found := placeholderSamples[typ]
+		if !found {
+			return nil, fmt.Errorf("invalid placeholder type (%s: %s)", name, typ)
+		}
+		samples[name] = sample
+	}
+
+	used := map[string]struct{}{}
+	for field, param := range raw.Params {
+		for _, m := range placeholderRegexp.FindAllStringSubmatch(param, -1) {
+			if _, found := raw.Placeholders[m[1]]; !found {
+				return nil, fmt.Errorf("placeholder (%s) is not declared", m[1])
+			}
+			used[m[1]] = struct{}{}
+		}
+		if field == "query_id" {
+			return nil, fmt.Errorf("query_id cannot be saved")
+		}
+	}
+	for name, _ := range raw.Placeholders {
+		if _, found := used[name]; !found {
+			return nil, fmt.Errorf("placeholder (%s) is not used", name)
+		}
+	}
+
+	sq := &savedQuery{RawSavedQuery: *raw, indexCacheable: true}
+	for _, field := range indexParams {
+		if placeholderRegexp.MatchString(raw.Params[field]) {
+			sq.indexCacheable = false
+		}
+	}
+	sq.stats.IndexCached = sq.indexCacheable
+
+	var err error
+	if raw.Endpoint == savedQueryFilter {
+		_, err = accountsFilterParser(sq.bind(samples))
+	} else {
+		_, err = accountsGroupParser(sq.bind(samples))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return sq, nil
+}
+
+func indexVersion() int {
+	return globals.Ls.Version() + globals.Is.Version()
+}
+
+// indexedIds returns the ids from the index planned at the previous execution while no like and
+// interest are modified.
+func (sq *savedQuery) indexedIds(compute func() ([]int, bool)) ([]int, bool) {
+	if !sq.indexCacheable {
+		return compute()
+	}
+
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	if sq.cached && sq.cachedVersion == indexVersion() {
+		return sq.cachedIds, sq.cachedIndexed
+	}
+	sq.cachedIds, sq.cachedIndexed = compute()
+	sq.cachedVersion = indexVersion()
+	sq.cached = true
+	return sq.cachedIds, sq.cachedIndexed
+}
+
+func (sq *savedQuery) executeFilter(values url.Values) (interface{}, int, error) {
+	afp, err := accountsFilterParser(values)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids, indexed := sq.indexedIds(func() ([]int, bool) {
+		_, ids, indexed := indexedIdsFromFilterParams(afp)
+		return ids, indexed
+	})
+	var ss store.StoreSource = globals.As.NewRangeAccountStoreSource()
+	if indexed {
+		ss = store.NewArrayStoreSource(ids)
+	}
+
+	// the indexed condition is checked again because ids are shared by executions
+	ansIds := store.ApplyFilter(ss, GenFilterFromAccountsFilterParams(afp), afp.limit)
+	rac := accountContainerFromIds(ansIds, afp.selects).ToRawAccountsContainer()
+	return &rac, len(ansIds), nil
+}
+
+func (sq *savedQuery) executeGroup(values url.Values) (interface{}, int, error) {
+	agp, err := accountsGroupParser(values)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids, indexed := sq.indexedIds(func() ([]int, bool) {
+		_, ids, indexed := indexedIdsFromGroupParams(agp)
+		return ids, indexed
+	})
+	var ss store.StoreSource = globals.As.NewRangeAccountStoreSource()
+	if indexed {
+		ss = store.NewArrayStoreSource(ids)
+	}
+
+	// filter without limit
+	filtered := store.ApplyFilter(ss, GenFilterFromAccountsGroupParams(agp), 1e8)
+	grs := groupFilteredIds(filtered, agp)
+	return ToRawGroupResponses(grs), len(grs), nil
+}
+
+func (sq *savedQuery) execute(queryParams url.Values) (interface{}, error) {
+	values := map[string]string{}
+	for field, param := range queryParams {
+		if field == "query_id" {
+			continue
+		}
+		typ, found := sq.Placeholders[field]
+		if !found {
+			return nil, fmt.Errorf("placeholder (%s) not found", field)
+		}
+		if len(param) != 1 {
+			return nil, fmt.Errorf("multiple params in placeholder (%s)", field)
+		}
+		if err := validatePlaceholderValue(typ, param[0]); err != nil {
+			return nil, err
+		}
+		values[field] = param[0]
+	}
+	for name, _ := range sq.Placeholders {
+		if _, found := values[name]; !found {
+			return nil, fmt.Errorf("placeholder (%s) is not specified", name)
+		}
+	}
+
+	before := time.Now()
+	var ret interface{}
+	var rows int
+	var err error
+	if sq.Endpoint == savedQueryFilter {
+		ret, rows, err = sq.executeFilter(sq.bind(values))
+	} else {
+		ret, rows, err = sq.executeGroup(sq.bind(values))
+	}
+	elapsed := time.Since(before).Nanoseconds()
+
+	sq.mu.Lock()
+	defer sq.mu.Unlock()
+	sq.stats.Executions++
+	if err != nil {
+		sq.stats.Errors++
+		return nil, err
+	}
+	sq.stats.Rows += rows
+	sq.stats.TotalNanos += elapsed
+	sq.stats.LastNanos = elapsed
+	if sq.stats.MaxNanos < elapsed {
+		sq.stats.MaxNanos = elapsed
+	}
+
+	return ret, nil
+}
+
+func SavedQueryRegisterCore(j []byte) *HlcHttpError {
+	var raw RawSavedQuery
+	if err := json.Unmarshal(j, &raw); err != nil {
+		return &HlcHttpError{http.StatusBadRequest, err}
+	}
+	sq, err := newSavedQuery(&raw)
+	if err != nil {
+		return &HlcHttpError{http.StatusBadRequest, err}
+	}
+
+	savedQueriesMu.Lock()
+	defer savedQueriesMu.Unlock()
+	if _, found := savedQueries[sq.Name]; found {
+		return &HlcHttpError{http.StatusBadRequest, fmt.Errorf("query (%s) is already registered", sq.Name)}
+	}
+	savedQueries[sq.Name] = sq
+	return nil
+}
+
+func SavedQueryDeleteCore(name string) *HlcHttpError {
+	savedQueriesMu.Lock()
+	defer savedQueriesMu.Unlock()
+	if _, found := savedQueries[name]; !found {
+		return &HlcHttpError{http.StatusNotFound, fmt.Errorf("query (%s) not found", name)}
+	}
+	delete(savedQueries, name)
+	return nil
+}
+
+func SavedQueryListCore() *RawSavedQueries {
+	savedQueriesMu.RLock()
+	defer savedQueriesMu.RUnlock()
+
+	ret := &RawSavedQueries{[]*RawSavedQueryWithStats{}}
+	for _, sq := range savedQueries {
+		sq.mu.Lock()
+		ret.Queries = append(ret.Queries, &RawSavedQueryWithStats{sq.RawSavedQuery, sq.stats})
+		sq.mu.Unlock()
+	}
+	sort.Slice(ret.Queries, func(i, j int) bool {
+		return ret.Queries[i].Name < ret.Queries[j].Name
+	})
+	return ret
+}
+
+func SavedQueryExecuteCore(name string, queryParams url.Values) (interface{}, *HlcHttpError) {
+	savedQueriesMu.RLock()
+	sq, found := savedQueries[name]
+	savedQueriesMu.RUnlock()
+	if !found {
+		return nil, &HlcHttpError{http.StatusNotFound, fmt.Errorf("query (%s) not found", name)}
+	}
+
+	ret, err := sq.execute(queryParams)
+	if err != nil {
+		log.Print(err)
+		return nil, &HlcHttpError{http.StatusBadRequest, err}
+	}
+	return ret, nil
+}
+
+func SavedQueryRegisterHandler(c echo.Context) error {
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	herr := SavedQueryRegisterCore(body)
+	if herr != nil {
+		log.Print(herr)
+		return c.String(herr.HttpStatusCode, "")
+	}
+	return c.JSON(http.StatusCreated, map[string]struct{}{})
+}
+
+func SavedQueryDeleteHandler(c echo.Context) error {
+	herr := SavedQueryDeleteCore(c.Param("name"))
+	if herr != nil {
+		log.Print(herr)
+		return c.String(herr.HttpStatusCode, "")
+	}
+	return c.JSON(http.StatusAccepted, map[string]struct{}{})
+}
+
+func SavedQueryListHandler(c echo.Context) error {
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, SavedQueryListCore())
+}
+
+func SavedQueryExecuteHandler(c echo.Context) error {
+	ret, err := SavedQueryExecuteCore(c.Param("name"), c.QueryParams())
+	if err != nil {
+		return c.String(err.HttpStatusCode, "")
+	}
+	return common.JsonResponseWithoutChunking(c, http.StatusOK, ret)
+}
@@ -1,6 +1,10 @@
 package handlers
 
-import "strconv"
+import (
+	"github.com/labstack/echo"
+	"net/url"
+	"strconv"
+)
 
 type HlcHttpError struct {
 	HttpStatusCode int
@@ -10,3 +14,12 @@ type HlcHttpError struct {
 func (e *HlcHttpError) Error() string {
 	return "status: " + strconv.Itoa(e.HttpStatusCode) + ", error: " + e.Err.Error()
 }
+
+// unescapedParam returns the path param name. echo routes by URL.RawPath when it is set, like for lowercase
+// percent-encoding or %2F, and then the param is still escaped.
+func unescapedParam(c echo.Context, name string) (string, error) {
+	if c.Request().URL.RawPath == "" {
+		return c.Param(name), nil
+	}
+	return url.PathUnescape(c.Param(name))
+}
@@ -14,6 +14,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 )
 
 func httpMain() {
@@ -33,6 +35,11 @@ func httpMain() {
 		}))
 	}
 
+	// no event fires with the fixed clock
+	if !common.IsFixedClock() {
+		e.Use(premiumMiddleware)
+	}
+
 	echo.NotFoundHandler = func(context echo.Context) error {
 		return context.String(http.StatusNotFound, "")
 	}
@@ -45,10 +52,38 @@ func httpMain() {
 	e.Any("/accounts/:id/recommend/*", echo.NotFoundHandler)
 	e.GET("/accounts/:id/suggest/", handlers.AccountsSuggestHandler)
 	e.Any("/accounts/:id/suggest/*", echo.NotFoundHandler)
+	e.GET("/accounts/top/", handlers.AccountsTopHandler)
+	e.Any("/accounts/top/*", echo.NotFoundHandler)
+	e.GET("/accounts/:id/similar/", handlers.AccountsSimilarHandler)
+	e.Any("/accounts/:id/similar/*", echo.NotFoundHandler)
 	e.POST("/accounts/new/", handlers.AccountsInsertHandler)
 	e.Any("/accounts/new/*", echo.NotFoundHandler)
+	e.POST("/accounts/query/", handlers.AccountsQueryHandler)
+	e.Any("/accounts/query/*", echo.NotFoundHandler)
 	e.POST("/accounts/likes/", handlers.AccountsLikesHandler)
 	e.Any("/accounts/likes/*", handlers.AccountsLikesHandler)
+	e.POST("/accounts/passes/", handlers.AccountsPassesHandler)
+	e.Any("/accounts/passes/*", echo.NotFoundHandler)
+	e.POST("/accounts/:id/premium/", handlers.AccountsPremiumHandler)
+	e.POST("/accounts/:id/blocks/", handlers.AccountsBlockHandler)
+	e.DELETE("/accounts/:id/blocks/", handlers.AccountsUnblockHandler)
+	e.GET("/countries/", handlers.CountriesHandler)
+	e.GET("/countries/:name/cities/", handlers.CitiesHandler)
+	e.GET("/interests/", handlers.InterestsHandler)
+	e.GET("/interests/:name/related/", handlers.RelatedInterestsHandler)
+	e.GET("/analytics/", handlers.AnalyticsStatusHandler)
+	e.POST("/analytics/run/", handlers.AnalyticsRunHandler)
+	e.GET("/analytics/accounts/:id/", handlers.AnalyticsAccountHandler)
+	e.GET("/analytics/pagerank/", handlers.AnalyticsPageRankHandler)
+	e.GET("/analytics/components/", handlers.AnalyticsComponentsHandler)
+	e.GET("/analytics/communities/", handlers.AnalyticsCommunitiesHandler)
+	e.GET("/queries/:name", handlers.SavedQueryExecuteHandler)
+	e.GET("/admin/queries/", handlers.SavedQueryListHandler)
+	e.POST("/admin/queries/", handlers.SavedQueryRegisterHandler)
+	e.DELETE("/admin/queries/:name", handlers.SavedQueryDeleteHandler)
+	e.GET("/admin/duplicates/", handlers.DuplicatesReportHandler)
+	e.POST("/admin/duplicates/", handlers.DuplicatesRunHandler)
+	e.POST("/admin/duplicates/merge/", handlers.DuplicatesMergeHandler)
 	e.POST("/accounts/:id/", echo.NotFoundHandler)
 	e.Any("/accounts/:id/*", echo.NotFoundHandler)
 
@@ -108,9 +143,73 @@ func loadZip() {
 			globals.Ls.InsertCommonLikeWithoutRangeCheck(l)
 		}
 	}
+
+	globals.Ri.Build()
+}
+
+// enableLSH builds the approximate index of similar likers when LSH_BANDS and LSH_ROWS are given.
+func enableLSH() {
+	bands, rows := os.Getenv("LSH_BANDS"), os.Getenv("LSH_ROWS")
+	if bands == "" && rows == "" {
+		return
+	}
+	b, err := strconv.Atoi(bands)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r, err := strconv.Atoi(rows)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := globals.Ls.EnableLSH(b, r); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// loadGazetteer loads the locations of cities from GAZETTEER. radius_km of recommend falls back to
+// country matching without it.
+func loadGazetteer() {
+	path := os.Getenv("GAZETTEER")
+	if path == "" {
+		return
+	}
+	if err := globals.Gz.Load(path); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("%d cities are loaded from the gazetteer", globals.Gz.Len())
+}
+
+// premiumMiddleware flips premium_now of the accounts whose premium periods started or expired by the server clock
+// before each request, and reindexes them.
+func premiumMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		globals.Ps.Tick(common.Now(), globals.Ri.Reindex)
+		return next(c)
+	}
+}
+
+// scheduleAnalytics computes the graph analytics every ANALYTICS_INTERVAL (like "10m") when it is given.
+func scheduleAnalytics() {
+	interval := os.Getenv("ANALYTICS_INTERVAL")
+	if interval == "" {
+		return
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		log.Fatal(err)
+	}
+	globals.Ga.Schedule(d)
 }
 
 func main() {
+	// the data is loaded before phones become unique, so the duplicates in it can be reported and merged
 	loadZip()
+	if os.Getenv("PHONE_UNIQUE") == "1" {
+		globals.As.RequireUniquePhones()
+	}
+	enableLSH()
+	loadGazetteer()
+	globals.Ps.ScheduleAll(common.Now())
+	scheduleAnalytics()
 	httpMain()
 }
@@ -3,39 +3,9 @@ package store
 import (
 	"fmt"
 	"hlc2018/common"
-	"strconv"
+	"sync"
 )
 
-type CompressedPhone struct {
-	Int int
-}
-
-func CompressedPhoneFromString(phone string) (CompressedPhone, error) {
-	if phone == "" {
-		return CompressedPhone{0}, nil
-	}
-	use := phone[3:5] + phone[6:]
-	ret, err := strconv.Atoi(use)
-	return CompressedPhone{ret}, err
-}
-
-const K_PHONE = 10000000
-
-func (cp CompressedPhone) String() string {
-	if cp.Int == 0 {
-		return ""
-	}
-	return fmt.Sprintf("8(9%02d)%07d", cp.Int/K_PHONE, cp.Int%K_PHONE)
-}
-
-func (cp CompressedPhone) HasPhoneCode(code int) bool {
-	if cp.Int == 0 {
-		return false
-	}
-	cpCode := 900 + cp.Int/K_PHONE
-	return cpCode == code
-}
-
 type StoredAccount struct {
 	ID            int
 	Fname         string
@@ -51,6 +21,12 @@ type StoredAccount struct {
 	City          int
 	Country       int
 	JoinedYear    common.JoinedYear
+	// nil when the account has no preferences
+	Preferences *common.Preferences
+}
+
+type cityCountry struct {
+	city, country int
 }
 
 type AccountStore struct {
@@ -58,15 +34,90 @@ type AccountStore struct {
 	cityIndex    *StringIndex
 	accounts     []*StoredAccount
 	emailToPK    map[string]int
+	// the number of accounts per pair of city and country. it is kept on inserts and updates
+	cityCountries map[cityCountry]int
+	phoneToPKs    map[CompressedPhone]map[int]struct{}
+	// a phone cannot be shared by accounts if true
+	uniquePhones bool
+	// guards accounts being added or deleted against Exists, which is called out of the requests
+	mu sync.RWMutex
 }
 
 func NewAccountStore() *AccountStore {
 	return &AccountStore{
-		countryIndex: NewStringIndex(),
-		cityIndex:    NewStringIndex(),
-		accounts:     nil,
-		emailToPK:    map[string]int{},
+		countryIndex:  NewStringIndex(),
+		cityIndex:     NewStringIndex(),
+		accounts:      nil,
+		emailToPK:     map[string]int{},
+		cityCountries: map[cityCountry]int{},
+		phoneToPKs:    map[CompressedPhone]map[int]struct{}{},
+	}
+}
+
+// RequireUniquePhones rejects inserts and updates with phones used by other accounts after it is called.
+func (as *AccountStore) RequireUniquePhones() {
+	as.uniquePhones = true
+}
+
+func (as *AccountStore) checkPhone(id int, cp CompressedPhone) error {
+	if !as.uniquePhones || cp.IsEmpty() {
+		return nil
+	}
+	for other, _ := range as.phoneToPKs[cp] {
+		if other != id {
+			return fmt.Errorf("phone is already registered. %d is using. your id : %d", other, id)
+		}
+	}
+	return nil
+}
+
+func (as *AccountStore) addPhone(id int, cp CompressedPhone) {
+	if cp.IsEmpty() {
+		return
+	}
+	if as.phoneToPKs[cp] == nil {
+		as.phoneToPKs[cp] = map[int]struct{}{}
+	}
+	as.phoneToPKs[cp][id] = struct{}{}
+}
+
+func (as *AccountStore) removePhone(id int, cp CompressedPhone) {
+	delete(as.phoneToPKs[cp], id)
+	if len(as.phoneToPKs[cp]) == 0 {
+		delete(as.phoneToPKs, cp)
+	}
+}
+
+func (as *AccountStore) addCityCountry(a *StoredAccount, diff int) {
+	key := cityCountry{a.City, a.Country}
+	as.cityCountries[key] += diff
+	if as.cityCountries[key] == 0 {
+		delete(as.cityCountries, key)
+	}
+}
+
+// CountryCounts returns the number of accounts per country id. accounts without country are not counted.
+func (as *AccountStore) CountryCounts() map[int]int {
+	ret := map[int]int{}
+	// 0 is the empty string
+	for countryId := 1; countryId < len(as.countryIndex.stringIdToPk); countryId++ {
+		if cnt := len(as.countryIndex.stringIdToPk[countryId]); cnt > 0 {
+			ret[countryId] = cnt
+		}
 	}
+	return ret
+}
+
+// CityCountsInCountry returns the number of accounts per city id among the accounts in countryId.
+// accounts without city are not counted.
+func (as *AccountStore) CityCountsInCountry(countryId int) map[int]int {
+	ret := map[int]int{}
+	for key, cnt := range as.cityCountries {
+		if key.country == countryId && key.city != 0 {
+			ret[key.city] = cnt
+		}
+	}
+	return ret
 }
 
 func (as *AccountStore) GetCountryId(country string) int {
@@ -92,6 +143,8 @@ func (as *AccountStore) ExtendSizeIfNeeded(nextSize int) {
 }
 
 func (as *AccountStore) InsertAccountCommon(a *common.Account) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
 	if a.ID == 0 {
 		return fmt.Errorf("id is not provided")
 	}
@@ -107,6 +160,9 @@ func (as *AccountStore) InsertAccountCommon(a *common.Account) error {
 	if err != nil {
 		return err
 	}
+	if err := as.checkPhone(a.ID, cp); err != nil {
+		return err
+	}
 
 	cityCode := as.cityIndex.SetString(a.ID, a.City)
 	countryCode := as.countryIndex.SetString(a.ID, a.Country)
@@ -128,7 +184,12 @@ func (as *AccountStore) InsertAccountCommon(a *common.Account) error {
 		Country:       countryCode,
 		JoinedYear:    a.JoinedYear,
 	}
+	if a.Preferences != nil && !a.Preferences.IsEmpty() {
+		nw.Preferences = a.Preferences
+	}
 	as.accounts[a.ID] = nw
+	as.addCityCountry(nw, 1)
+	as.addPhone(a.ID, cp)
 
 	return nil
 }
@@ -157,6 +218,9 @@ func (as *AccountStore) UpdateAccountCommon(a *common.Account) error {
 	if err != nil {
 		return err
 	}
+	if err := as.checkPhone(a.ID, cp); err != nil {
+		return err
+	}
 
 	//Birth:         a.Birth,
 	//City:          cityCode,
@@ -164,6 +228,8 @@ func (as *AccountStore) UpdateAccountCommon(a *common.Account) error {
 	//JoinedYear:    a.JoinedYear,
 
 	me := as.accounts[a.ID]
+	as.addCityCountry(me, -1)
+	defer as.addCityCountry(me, 1)
 
 	if a.Fname != "" {
 		me.Fname = a.Fname
@@ -188,7 +254,9 @@ func (as *AccountStore) UpdateAccountCommon(a *common.Account) error {
 		me.Sex = a.Sex
 	}
 	if a.Phone != "" {
+		as.removePhone(me.ID, me.Phone)
 		me.Phone = cp
+		as.addPhone(me.ID, cp)
 	}
 	if a.Birth != 0 {
 		me.Birth = a.Birth
@@ -204,21 +272,87 @@ func (as *AccountStore) UpdateAccountCommon(a *common.Account) error {
 	if a.JoinedYear.Int8 > 0 {
 		me.JoinedYear = a.JoinedYear
 	}
+	// given preferences replace the current ones. empty preferences clear them
+	if a.Preferences != nil {
+		me.Preferences = a.Preferences
+		if a.Preferences.IsEmpty() {
+			me.Preferences = nil
+		}
+	}
 
 	return nil
 }
 
-func (as *AccountStore) NewRangeAccountStoreSource() *RangeStoreSource {
-	return NewRangeStoreSource(len(as.accounts), 0, -1)
+// SetPremium replaces the premium period of id and recomputes Premium_now at now.
+func (as *AccountStore) SetPremium(id, start, end, now int) error {
+	if id >= len(as.accounts) || as.accounts[id] == nil {
+		return fmt.Errorf("%d is not registered yet", id)
+	}
+	me := as.accounts[id]
+	me.Premium_start = start
+	me.Premium_end = end
+	me.Premium_now = common.IsPremiumNow(start, end, now)
+	return nil
+}
+
+// accountStoreSource skips the gaps of ids left by inserts with sparse ids and deleted accounts.
+type accountStoreSource struct {
+	*RangeStoreSource
+	as *AccountStore
+}
+
+func (ss *accountStoreSource) Next() bool {
+	for ss.RangeStoreSource.Next() {
+		if ss.as.accounts[ss.Value()] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (as *AccountStore) NewRangeAccountStoreSource() StoreSource {
+	return &accountStoreSource{NewRangeStoreSource(len(as.accounts), 0, -1), as}
+}
+
+func (as *AccountStore) NewAscendingRangeAccountStoreSource() StoreSource {
+	return &accountStoreSource{NewRangeStoreSource(0, len(as.accounts), 1), as}
 }
 
 func (as *AccountStore) GetStoredAccount(id int) (*StoredAccount, error) {
-	if len(as.accounts) <= id {
+	if id < 0 || len(as.accounts) <= id || as.accounts[id] == nil {
 		return nil, fmt.Errorf("account not found")
 	}
 	return as.accounts[id], nil
 }
 
+// DeleteAccount removes id from the store and its indexes. the id is left as a gap.
+func (as *AccountStore) DeleteAccount(id int) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	me, err := as.GetStoredAccount(id)
+	if err != nil {
+		return err
+	}
+	delete(as.emailToPK, me.Email)
+	as.removePhone(id, me.Phone)
+	as.addCityCountry(me, -1)
+	as.cityIndex.DeleteStringsFromPk(id)
+	as.countryIndex.DeleteStringsFromPk(id)
+	as.accounts[id] = nil
+	return nil
+}
+
+// Exists returns whether each id is a stored account.
+func (as *AccountStore) Exists() []bool {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	ret := make([]bool, len(as.accounts))
+	for id, a := range as.accounts {
+		ret[id] = a != nil
+	}
+	return ret
+}
+
 func (as *AccountStore) GetStoredAccountWithoutError(id int) *StoredAccount {
 	return as.accounts[id]
 }
@@ -0,0 +1,76 @@
+package store
+
+// BlockStore holds the directed sets of accounts blocked by each account.
+type BlockStore struct {
+	// id -> accounts blocked by id
+	blocks []map[int]struct{}
+	// id -> accounts blocking id
+	blockedBy []map[int]struct{}
+}
+
+func NewBlockStore() *BlockStore {
+	return &BlockStore{}
+}
+
+func (bs *BlockStore) ExtendSizeIfNeeded(nextSize int) {
+	for len(bs.blocks) < nextSize {
+		bs.blocks = append(bs.blocks, nil)
+		bs.blockedBy = append(bs.blockedBy, nil)
+	}
+}
+
+func (bs *BlockStore) Block(from, to int) {
+	if from < to {
+		bs.ExtendSizeIfNeeded(to + 1)
+	} else {
+		bs.ExtendSizeIfNeeded(from + 1)
+	}
+	if bs.blocks[from] == nil {
+		bs.blocks[from] = map[int]struct{}{}
+	}
+	if bs.blockedBy[to] == nil {
+		bs.blockedBy[to] = map[int]struct{}{}
+	}
+	bs.blocks[from][to] = struct{}{}
+	bs.blockedBy[to][from] = struct{}{}
+}
+
+func (bs *BlockStore) Unblock(from, to int) {
+	if from >= len(bs.blocks) || to >= len(bs.blocks) {
+		return
+	}
+	delete(bs.blocks[from], to)
+	delete(bs.blockedBy[to], from)
+}
+
+// IsBlocked returns true if either of id and other blocks the other.
+func (bs *BlockStore) IsBlocked(id, other int) bool {
+	if id >= len(bs.blocks) || other >= len(bs.blocks) {
+		return false
+	}
+	if _, found := bs.blocks[id][other]; found {
+		return true
+	}
+	_, found := bs.blockedBy[id][other]
+	return found
+}
+
+// MoveBlocks re-points the blocks by and of from to into, and leaves from without blocks.
+// blocks between from and into are dropped.
+func (bs *BlockStore) MoveBlocks(from, into int) {
+	if from >= len(bs.blocks) {
+		return
+	}
+	for to, _ := range bs.blocks[from] {
+		bs.Unblock(from, to)
+		if to != into {
+			bs.Block(into, to)
+		}
+	}
+	for by, _ := range bs.blockedBy[from] {
+		bs.Unblock(by, from)
+		if by != into {
+			bs.Block(by, into)
+		}
+	}
+}
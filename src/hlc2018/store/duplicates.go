@@ -0,0 +1,138 @@
+package store
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DuplicateByPhone     = "phone"
+	DuplicateByNameBirth = "name_birth"
+	DuplicateByEmail     = "email"
+)
+
+// local parts shorter than this are compared only after normalization, because one deletion matches too much
+const minNearEmailLocalLength = 5
+
+type DuplicatePair struct {
+	// Ids[0] < Ids[1]
+	Ids     [2]int
+	Reasons []string
+}
+
+type duplicateCollector struct {
+	maxGroup int
+	pairs    map[[2]int]map[string]struct{}
+}
+
+// addGroup adds every pair in ids. groups larger than maxGroup are skipped as they are not likely duplicates.
+func (dc *duplicateCollector) addGroup(ids []int, reason string) {
+	if len(ids) < 2 || len(ids) > dc.maxGroup {
+		return
+	}
+	for i := 0; i < len(ids); i++ {
+		for j := i + 1; j < len(ids); j++ {
+			key := [2]int{ids[i], ids[j]}
+			if key[0] > key[1] {
+				key[0], key[1] = key[1], key[0]
+			}
+			if dc.pairs[key] == nil {
+				dc.pairs[key] = map[string]struct{}{}
+			}
+			dc.pairs[key][reason] = struct{}{}
+		}
+	}
+}
+
+func (dc *duplicateCollector) addGroups(groups map[string][]int, reason string) {
+	for _, ids := range groups {
+		dc.addGroup(ids, reason)
+	}
+}
+
+// normalizeEmailLocal lowercases the local part and drops dots and the suffix after +.
+func normalizeEmailLocal(local string) string {
+	local = strings.ToLower(local)
+	if i := strings.IndexByte(local, '+'); i != -1 {
+		local = local[:i]
+	}
+	return strings.Replace(local, ".", "", -1)
+}
+
+// nearEmailGroups groups emails of a domain whose normalized local parts are the same or the same after deleting
+// one character from either of them.
+func nearEmailGroups(locals map[int]string) map[string][]int {
+	groups := map[string][]int{}
+	for id, local := range locals {
+		keys := map[string]struct{}{local: {}}
+		if len(local) >= minNearEmailLocalLength {
+			for i := 0; i < len(local); i++ {
+				keys[local[:i]+local[i+1:]] = struct{}{}
+			}
+		}
+		for key, _ := range keys {
+			groups[key] = append(groups[key], id)
+		}
+	}
+	return groups
+}
+
+// FindDuplicates returns pairs of accounts which share the phone, fname, sname and birth, or nearly the same email.
+func (as *AccountStore) FindDuplicates(maxGroup int) []*DuplicatePair {
+	dc := duplicateCollector{maxGroup, map[[2]int]map[string]struct{}{}}
+
+	for _, ids := range as.phoneToPKs {
+		var group []int
+		for id, _ := range ids {
+			group = append(group, id)
+		}
+		dc.addGroup(group, DuplicateByPhone)
+	}
+
+	nameBirths := map[string][]int{}
+	domains := map[string]map[int]string{}
+	for _, a := range as.accounts {
+		if a == nil {
+			continue
+		}
+		if a.Fname != "" && a.Sname != "" {
+			key := a.Fname + "\x00" + a.Sname + "\x00" + strconv.Itoa(a.Birth)
+			nameBirths[key] = append(nameBirths[key], a.ID)
+		}
+		at := strings.LastIndexByte(a.Email, '@')
+		if at == -1 {
+			continue
+		}
+		domain := strings.ToLower(a.Email[at+1:])
+		if domains[domain] == nil {
+			domains[domain] = map[int]string{}
+		}
+		domains[domain][a.ID] = normalizeEmailLocal(a.Email[:at])
+	}
+	dc.addGroups(nameBirths, DuplicateByNameBirth)
+	// domain by domain to keep the keys of deletions small
+	for _, locals := range domains {
+		dc.addGroups(nearEmailGroups(locals), DuplicateByEmail)
+	}
+
+	var ret []*DuplicatePair
+	for key, reasons := range dc.pairs {
+		dp := &DuplicatePair{Ids: key}
+		for reason, _ := range reasons {
+			dp.Reasons = append(dp.Reasons, reason)
+		}
+		sort.Strings(dp.Reasons)
+		ret = append(ret, dp)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if len(ret[i].Reasons) != len(ret[j].Reasons) {
+			return len(ret[i].Reasons) > len(ret[j].Reasons)
+		}
+		if ret[i].Ids[0] != ret[j].Ids[0] {
+			return ret[i].Ids[0] < ret[j].Ids[0]
+		}
+		return ret[i].Ids[1] < ret[j].Ids[1]
+	})
+	return ret
+}
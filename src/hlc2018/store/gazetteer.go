@@ -0,0 +1,78 @@
+package store
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type LatLon struct {
+	Lat, Lon float64
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm returns the great-circle distance between a and b.
+func DistanceKm(a, b LatLon) float64 {
+	toRad := math.Pi / 180
+	dLat := (b.Lat - a.Lat) * toRad
+	dLon := (b.Lon - a.Lon) * toRad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(a.Lat*toRad)*math.Cos(b.Lat*toRad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Gazetteer maps city names, the same strings as in the city index, to their locations.
+type Gazetteer struct {
+	locations map[string]LatLon
+}
+
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{map[string]LatLon{}}
+}
+
+// Load reads lines of "city<TAB>lat<TAB>lon". empty lines and lines starting with # are skipped.
+func (g *Gazetteer) Load(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tmp := strings.Split(line, "\t")
+		if len(tmp) != 3 {
+			return fmt.Errorf("%s:%d: expected 3 columns", path, lineNo)
+		}
+		lat, err := strconv.ParseFloat(tmp[1], 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return fmt.Errorf("%s:%d: invalid latitude (%s)", path, lineNo, tmp[1])
+		}
+		lon, err := strconv.ParseFloat(tmp[2], 64)
+		if err != nil || lon < -180 || lon > 180 {
+			return fmt.Errorf("%s:%d: invalid longitude (%s)", path, lineNo, tmp[2])
+		}
+		g.locations[tmp[0]] = LatLon{lat, lon}
+	}
+	return scanner.Err()
+}
+
+func (g *Gazetteer) Len() int {
+	return len(g.locations)
+}
+
+func (g *Gazetteer) Lookup(city string) (LatLon, bool) {
+	if city == "" {
+		return LatLon{}, false
+	}
+	ll, found := g.locations[city]
+	return ll, found
+}
@@ -40,10 +40,12 @@ type StringIndex struct {
 	sim          *StringIdMapper
 	pkToStringId []map[int]struct{}
 	stringIdToPk []map[int]struct{}
+	// version is incremented on every modification
+	version int
 }
 
 func NewStringIndex() *StringIndex {
-	is := &StringIndex{newStringIdMapper(), nil, nil}
+	is := &StringIndex{newStringIdMapper(), nil, nil, 0}
 	is.insertIfNeeded("")
 	return is
 }
@@ -67,6 +69,7 @@ func (si *StringIndex) SetString(pk int, s string) int {
 	insertedId := si.insertIfNeeded(s)
 	si.pkToStringId[pk][insertedId] = struct{}{}
 	si.stringIdToPk[insertedId][pk] = struct{}{}
+	si.version++
 	return insertedId
 }
 
@@ -75,6 +78,11 @@ func (si *StringIndex) DeleteStringsFromPk(pk int) {
 		delete(si.stringIdToPk[currentSID], pk)
 	}
 	si.pkToStringId[pk] = map[int]struct{}{}
+	si.version++
+}
+
+func (si *StringIndex) Version() int {
+	return si.version
 }
 
 func (si *StringIndex) ConvertStringToStringId(s string) int {
@@ -3,6 +3,7 @@ package store
 import (
 	"fmt"
 	"hlc2018/common"
+	"math"
 )
 
 type InterestStore struct {
@@ -48,6 +49,9 @@ func (is *InterestStore) ContainsAnyFromInterests(vs []string) map[int]struct{}
 }
 
 func (is *InterestStore) ContainsAll(id int, vs []string) bool {
+	if id >= len(is.pkToStringId) {
+		return len(vs) == 0
+	}
 	for _, s := range vs {
 		interestId, found := is.sim.GetWithFound(s)
 		if !found {
@@ -61,6 +65,9 @@ func (is *InterestStore) ContainsAll(id int, vs []string) bool {
 }
 
 func (is *InterestStore) ContainsAny(id int, vs []string) bool {
+	if id >= len(is.pkToStringId) {
+		return false
+	}
 	for _, s := range vs {
 		interestId, found := is.sim.GetWithFound(s)
 		if !found {
@@ -73,6 +80,13 @@ func (is *InterestStore) ContainsAny(id int, vs []string) bool {
 	return false
 }
 
+func (is *InterestStore) InterestsCount(id int) int {
+	if id >= len(is.pkToStringId) {
+		return 0
+	}
+	return len(is.pkToStringId[id])
+}
+
 func (is *InterestStore) GetInterestStrings(id int) []string {
 	ret := []string{}
 	for interestId, _ := range is.pkToStringId[id] {
@@ -100,6 +114,134 @@ func (is *InterestStore) GetSuggestInterestIds(id int) map[int]int {
 	return mp
 }
 
+// JaccardSimilarities returns the jaccard index of the interests of id with every account sharing any of them.
+func (is *InterestStore) JaccardSimilarities(id int) map[int]float64 {
+	ret := map[int]float64{}
+	if id >= len(is.pkToStringId) {
+		return ret
+	}
+	mine := len(is.pkToStringId[id])
+	for other, shared := range is.GetSuggestInterestIds(id) {
+		if other == id {
+			continue
+		}
+		ret[other] = float64(shared) / float64(mine+len(is.pkToStringId[other])-shared)
+	}
+	return ret
+}
+
+// IdfSimilarities returns the sum of InterestIdf of the interests shared by id with every account.
+func (is *InterestStore) IdfSimilarities(id int) map[int]float64 {
+	ret := map[int]float64{}
+	if id >= len(is.pkToStringId) {
+		return ret
+	}
+	for interestId, _ := range is.pkToStringId[id] {
+		idf := is.InterestIdf(interestId)
+		for other, _ := range is.stringIdToPk[interestId] {
+			if other != id {
+				ret[other] += idf
+			}
+		}
+	}
+	return ret
+}
+
+// CommonInterestIds returns interest ids which both id and otherId have.
+func (is *InterestStore) CommonInterestIds(id, otherId int) []int {
+	var ret []int
+	if id >= len(is.pkToStringId) || otherId >= len(is.pkToStringId) {
+		return ret
+	}
+	l, r := is.pkToStringId[id], is.pkToStringId[otherId]
+	if len(l) > len(r) {
+		l, r = r, l
+	}
+	for interestId, _ := range l {
+		if _, ok := r[interestId]; ok {
+			ret = append(ret, interestId)
+		}
+	}
+	return ret
+}
+
+// InterestIdf returns the inverse document frequency of interestId over accounts.
+func (is *InterestStore) InterestIdf(interestId int) float64 {
+	df := len(is.stringIdToPk[interestId])
+	if df == 0 {
+		return 0
+	}
+	return math.Log(float64(len(is.pkToStringId)) / float64(df))
+}
+
+// GetInterestId returns the id of interest or -1 if nobody has it.
+func (is *InterestStore) GetInterestId(interest string) int {
+	return is.sim.Get(interest)
+}
+
+// CountInterests returns the number of accounts passing filter per interest id.
+func (is *InterestStore) CountInterests(filter func(id int) bool) map[int]int {
+	ret := map[int]int{}
+	// 0 is the empty string
+	for interestId := 1; interestId < len(is.stringIdToPk); interestId++ {
+		cnt := 0
+		for pk, _ := range is.stringIdToPk[interestId] {
+			if filter(pk) {
+				cnt++
+			}
+		}
+		if cnt > 0 {
+			ret[interestId] = cnt
+		}
+	}
+	return ret
+}
+
+// CountAccountsWithInterests returns the number of accounts passing filter which have any interest.
+func (is *InterestStore) CountAccountsWithInterests(filter func(id int) bool) int {
+	cnt := 0
+	for pk, interests := range is.pkToStringId {
+		if len(interests) > 0 && filter(pk) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// CoOccurrences returns the number of accounts passing filter per interest id which they have together
+// with interestId.
+func (is *InterestStore) CoOccurrences(interestId int, filter func(id int) bool) map[int]int {
+	ret := map[int]int{}
+	for pk, _ := range is.stringIdToPk[interestId] {
+		if !filter(pk) {
+			continue
+		}
+		for other, _ := range is.pkToStringId[pk] {
+			if other != interestId {
+				ret[other]++
+			}
+		}
+	}
+	return ret
+}
+
+func (is *InterestStore) InterestIdToString(interestId int) string {
+	return is.sim.strings[interestId]
+}
+
+// MoveInterests adds the interests of from to into and removes them from from.
+func (is *InterestStore) MoveInterests(from, into int) {
+	if from >= len(is.pkToStringId) {
+		return
+	}
+	is.ExtendSizeIfNeeded(into + 1)
+	for interestId, _ := range is.pkToStringId[from] {
+		is.pkToStringId[into][interestId] = struct{}{}
+		is.stringIdToPk[interestId][into] = struct{}{}
+	}
+	is.DeleteStringsFromPk(from)
+}
+
 func (is *InterestStore) UpdateInterests(id int, interests []string) error {
 	if id >= len(is.pkToStringId) {
 		return fmt.Errorf("id out of range : %d", id)
@@ -0,0 +1,67 @@
+package store
+
+import "sort"
+
+// likeDegreeOrder groups accounts by the number of received likes, so that they can be visited in descending
+// order without sorting all accounts. accounts without received likes are not kept.
+type likeDegreeOrder struct {
+	// degree -> ids. buckets[0] is always empty
+	buckets []map[int]struct{}
+}
+
+func newLikeDegreeOrder() *likeDegreeOrder {
+	return &likeDegreeOrder{[]map[int]struct{}{{}}}
+}
+
+// move moves id from the bucket of degree from to the bucket of degree to.
+func (o *likeDegreeOrder) move(id, from, to int) {
+	if from > 0 {
+		delete(o.buckets[from], id)
+	}
+	if to == 0 {
+		return
+	}
+	for len(o.buckets) <= to {
+		o.buckets = append(o.buckets, map[int]struct{}{})
+	}
+	o.buckets[to][id] = struct{}{}
+}
+
+// walk visits accounts in descending order of degree and then id until visit returns false.
+func (o *likeDegreeOrder) walk(visit func(id, degree int) bool) {
+	for degree := len(o.buckets) - 1; degree > 0; degree-- {
+		if len(o.buckets[degree]) == 0 {
+			continue
+		}
+		ids := make([]int, 0, len(o.buckets[degree]))
+		for id, _ := range o.buckets[degree] {
+			ids = append(ids, id)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+		for _, id := range ids {
+			if !visit(id, degree) {
+				return
+			}
+		}
+	}
+}
+
+// WalkByLikersCount visits accounts with received likes in descending order of LikersCount and then id
+// until visit returns false.
+func (ls *LikeStore) WalkByLikersCount(visit func(id, count int) bool) {
+	ls.degreeOrder.walk(visit)
+}
+
+// LikersCountBetween returns the number of likes received by id with ts in [from, to].
+func (ls *LikeStore) LikersCountBetween(id, from, to int) int {
+	if id >= len(ls.backward) {
+		return 0
+	}
+	cnt := 0
+	for _, sl := range ls.backward[id] {
+		if from <= sl.ts && sl.ts <= to {
+			cnt++
+		}
+	}
+	return cnt
+}
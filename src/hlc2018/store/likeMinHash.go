@@ -0,0 +1,168 @@
+package store
+
+import (
+	"fmt"
+	"math"
+)
+
+// likeLSH finds accounts whose likee sets are similar by MinHash signatures split into bands.
+// two accounts become candidates when all rows of any band are equal, which happens with probability
+// 1 - (1 - j^rows)^bands for the jaccard similarity j of their likee sets.
+type likeLSH struct {
+	bands, rows int
+	seeds       []uint64
+	// nil for accounts without likes
+	signatures [][]uint32
+	// band -> hash of the rows in the band -> ids
+	buckets []map[uint64]map[int]struct{}
+}
+
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+func newLikeLSH(bands, rows int) *likeLSH {
+	lsh := &likeLSH{bands: bands, rows: rows}
+	for i := 0; i < bands*rows; i++ {
+		lsh.seeds = append(lsh.seeds, splitMix64(uint64(i)+1))
+	}
+	for i := 0; i < bands; i++ {
+		lsh.buckets = append(lsh.buckets, map[uint64]map[int]struct{}{})
+	}
+	return lsh
+}
+
+func (lsh *likeLSH) hash(i, likee int) uint32 {
+	return uint32(splitMix64(uint64(likee) ^ lsh.seeds[i]))
+}
+
+func (lsh *likeLSH) bandKey(sig []uint32, band int) uint64 {
+	key := uint64(band)
+	for _, v := range sig[band*lsh.rows : (band+1)*lsh.rows] {
+		key = splitMix64(key ^ uint64(v))
+	}
+	return key
+}
+
+func (lsh *likeLSH) extendSizeIfNeeded(nextSize int) {
+	for len(lsh.signatures) < nextSize {
+		lsh.signatures = append(lsh.signatures, nil)
+	}
+}
+
+// insertLike updates the signature of from and moves it to the buckets of changed bands.
+func (lsh *likeLSH) insertLike(from, to int) {
+	lsh.extendSizeIfNeeded(from + 1)
+
+	old := lsh.signatures[from]
+	sig := make([]uint32, len(lsh.seeds))
+	for i := range sig {
+		sig[i] = lsh.hash(i, to)
+		if old != nil && old[i] < sig[i] {
+			sig[i] = old[i]
+		}
+	}
+
+	for band := 0; band < lsh.bands; band++ {
+		newKey := lsh.bandKey(sig, band)
+		if old != nil {
+			oldKey := lsh.bandKey(old, band)
+			if oldKey == newKey {
+				continue
+			}
+			delete(lsh.buckets[band][oldKey], from)
+			if len(lsh.buckets[band][oldKey]) == 0 {
+				delete(lsh.buckets[band], oldKey)
+			}
+		}
+		if lsh.buckets[band][newKey] == nil {
+			lsh.buckets[band][newKey] = map[int]struct{}{}
+		}
+		lsh.buckets[band][newKey][from] = struct{}{}
+	}
+	lsh.signatures[from] = sig
+}
+
+// reset removes the signature of id. it is used when likes of id are removed, which MinHash cannot follow.
+func (lsh *likeLSH) reset(id int) {
+	if id >= len(lsh.signatures) || lsh.signatures[id] == nil {
+		return
+	}
+	sig := lsh.signatures[id]
+	for band := 0; band < lsh.bands; band++ {
+		key := lsh.bandKey(sig, band)
+		delete(lsh.buckets[band][key], id)
+		if len(lsh.buckets[band][key]) == 0 {
+			delete(lsh.buckets[band], key)
+		}
+	}
+	lsh.signatures[id] = nil
+}
+
+func (lsh *likeLSH) candidates(id int) map[int]struct{} {
+	ret := map[int]struct{}{}
+	if id >= len(lsh.signatures) || lsh.signatures[id] == nil {
+		return ret
+	}
+	sig := lsh.signatures[id]
+	for band := 0; band < lsh.bands; band++ {
+		for other, _ := range lsh.buckets[band][lsh.bandKey(sig, band)] {
+			if other != id {
+				ret[other] = struct{}{}
+			}
+		}
+	}
+	return ret
+}
+
+// EnableLSH builds MinHash signatures of the current likes. they are maintained by InsertLike after that.
+func (ls *LikeStore) EnableLSH(bands, rows int) error {
+	if bands <= 0 || rows <= 0 {
+		return fmt.Errorf("bands and rows should be positive (bands = %d, rows = %d)", bands, rows)
+	}
+	lsh := newLikeLSH(bands, rows)
+	for from, sls := range ls.forward {
+		for _, sl := range sls {
+			lsh.insertLike(from, sl.to)
+		}
+	}
+	ls.lsh = lsh
+	return nil
+}
+
+func (ls *LikeStore) LSHEnabled() bool {
+	return ls.lsh != nil
+}
+
+// LikeSimilarity computes the similarity between id and otherId by metric exactly.
+func (ls *LikeStore) LikeSimilarity(id, otherId int, metric LikeSimilarityMetric) float64 {
+	contributions := ls.LikeSimilarityContributions(id, otherId, metric)
+	if len(contributions) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, lc := range contributions {
+		sum += lc.Contribution
+	}
+	return metric.Normalize(sum, len(ls.forwardMap[id]), len(ls.forwardMap[otherId]), len(contributions))
+}
+
+// ApproximateLikeSimilarities works as LikeSimilaritiesWithMetric but only for the candidates from LSH.
+// it falls back to the exact one when LSH is not enabled.
+func (ls *LikeStore) ApproximateLikeSimilarities(id int, metric LikeSimilarityMetric) map[int]float64 {
+	if ls.lsh == nil {
+		return ls.LikeSimilaritiesWithMetric(id, metric)
+	}
+
+	mp := map[int]float64{}
+	for other, _ := range ls.lsh.candidates(id) {
+		similarity := ls.LikeSimilarity(id, other, metric)
+		if similarity > 0 && !math.IsNaN(similarity) {
+			mp[other] = similarity
+		}
+	}
+	return mp
+}
@@ -0,0 +1,92 @@
+package store
+
+import "sync"
+
+// likeNeighbours is the similarities of an account with the other likers of its likees.
+type likeNeighbours struct {
+	similarities map[int]float64
+	ordered      []int
+}
+
+// likeNeighbourCache holds likeNeighbours per account and metric.
+// only metrics which depend on the common likees alone are cached, because a like from x to y changes
+// their similarities only between x and the likers of y. such entries are dropped by InsertLike.
+type likeNeighbourCache struct {
+	mu      sync.Mutex
+	entries map[int]map[LikeSimilarityMetric]*likeNeighbours
+	size    int
+}
+
+const maxLikeNeighbourCacheEntries = 100000
+
+func newLikeNeighbourCache() *likeNeighbourCache {
+	return &likeNeighbourCache{entries: map[int]map[LikeSimilarityMetric]*likeNeighbours{}}
+}
+
+func (c *likeNeighbourCache) get(id int, metric LikeSimilarityMetric) (*likeNeighbours, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, found := c.entries[id][metric]
+	return n, found
+}
+
+func (c *likeNeighbourCache) put(id int, metric LikeSimilarityMetric, n *likeNeighbours) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size >= maxLikeNeighbourCacheEntries {
+		c.entries = map[int]map[LikeSimilarityMetric]*likeNeighbours{}
+		c.size = 0
+	}
+	if c.entries[id] == nil {
+		c.entries[id] = map[LikeSimilarityMetric]*likeNeighbours{}
+	}
+	if _, found := c.entries[id][metric]; !found {
+		c.size++
+	}
+	c.entries[id][metric] = n
+}
+
+// invalidateLike drops the entries changed by a like from from to the likee whose likers are likers.
+func (c *likeNeighbourCache) invalidateLike(from int, likers []storedLike) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// nothing to do while loading data
+	if c.size == 0 {
+		return
+	}
+	c.drop(from)
+	for _, sl := range likers {
+		c.drop(sl.to)
+	}
+}
+
+func (c *likeNeighbourCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[int]map[LikeSimilarityMetric]*likeNeighbours{}
+	c.size = 0
+}
+
+func (c *likeNeighbourCache) drop(id int) {
+	if mp, found := c.entries[id]; found {
+		c.size -= len(mp)
+		delete(c.entries, id)
+	}
+}
+
+// CachedLikeSimilarities works as LikeSimilaritiesWithMetric and also returns the ids ordered by similarity.
+// the results are shared between calls and must not be modified.
+func (ls *LikeStore) CachedLikeSimilarities(id int, metric LikeSimilarityMetric) (map[int]float64, []int) {
+	if !metric.OnlyCommonLikees() {
+		similarities := ls.LikeSimilaritiesWithMetric(id, metric)
+		return similarities, OrderBySimilarity(similarities)
+	}
+
+	if n, found := ls.neighbourCache.get(id, metric); found {
+		return n.similarities, n.ordered
+	}
+	similarities := ls.LikeSimilaritiesWithMetric(id, metric)
+	n := &likeNeighbours{similarities, OrderBySimilarity(similarities)}
+	ls.neighbourCache.put(id, metric, n)
+	return n.similarities, n.ordered
+}
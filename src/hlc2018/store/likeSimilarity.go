@@ -0,0 +1,149 @@
+package store
+
+import (
+	"math"
+	"sort"
+)
+
+// LikeSimilarityMetric defines the similarity between two likers over the likees liked by both.
+type LikeSimilarityMetric interface {
+	// Contribution is added to the similarity for each common likee.
+	// ts and otherTs are the averages of timestamps of likes to the likee.
+	Contribution(ts, otherTs float64) float64
+	// Normalize converts the sum of contributions into the similarity.
+	// likees and otherLikees are the numbers of distinct likees, common is the number of common likees.
+	Normalize(sum float64, likees, otherLikees, common int) float64
+	// OnlyCommonLikees reports whether Normalize ignores likees and otherLikees.
+	// similarities by such metrics can be cached, see likeNeighbourCache.
+	OnlyCommonLikees() bool
+}
+
+// hlcSimilarity is the sum of 1 / |ts difference| over the common likees.
+type hlcSimilarity struct{}
+
+func (hlcSimilarity) Contribution(ts, otherTs float64) float64 {
+	div := ts - otherTs
+	if div == 0 {
+		div = 1
+	}
+	return 1 / math.Abs(div)
+}
+
+func (hlcSimilarity) Normalize(sum float64, likees, otherLikees, common int) float64 {
+	return sum
+}
+
+func (hlcSimilarity) OnlyCommonLikees() bool {
+	return true
+}
+
+// jaccardSimilarity is |common likees| / |union of likees|.
+type jaccardSimilarity struct{}
+
+func (jaccardSimilarity) Contribution(ts, otherTs float64) float64 {
+	return 1
+}
+
+func (jaccardSimilarity) Normalize(sum float64, likees, otherLikees, common int) float64 {
+	return sum / float64(likees+otherLikees-common)
+}
+
+func (jaccardSimilarity) OnlyCommonLikees() bool {
+	return false
+}
+
+// cosineSimilarity is the cosine of binary vectors of likees.
+type cosineSimilarity struct{}
+
+func (cosineSimilarity) Contribution(ts, otherTs float64) float64 {
+	return 1
+}
+
+func (cosineSimilarity) Normalize(sum float64, likees, otherLikees, common int) float64 {
+	return sum / math.Sqrt(float64(likees)*float64(otherLikees))
+}
+
+func (cosineSimilarity) OnlyCommonLikees() bool {
+	return false
+}
+
+// decaySimilarity counts common likees, each of which halves every halfLife seconds of ts difference.
+type decaySimilarity struct {
+	halfLife float64
+}
+
+func (ds decaySimilarity) Contribution(ts, otherTs float64) float64 {
+	return math.Exp2(-math.Abs(ts-otherTs) / ds.halfLife)
+}
+
+func (decaySimilarity) Normalize(sum float64, likees, otherLikees, common int) float64 {
+	return sum
+}
+
+func (decaySimilarity) OnlyCommonLikees() bool {
+	return true
+}
+
+var LikeSimilarityMetrics = map[string]LikeSimilarityMetric{
+	"hlc":     hlcSimilarity{},
+	"jaccard": jaccardSimilarity{},
+	"cosine":  cosineSimilarity{},
+	"decay":   decaySimilarity{30 * 24 * 60 * 60},
+}
+
+const DefaultLikeSimilarityMetric = "hlc"
+
+// LikeSimilaritiesWithMetric returns the similarity of id with every other liker of id's likees.
+func (ls *LikeStore) LikeSimilaritiesWithMetric(id int, metric LikeSimilarityMetric) map[int]float64 {
+	mp := map[int]float64{}
+	if id >= len(ls.forward) {
+		return mp
+	}
+
+	commons := map[int]int{}
+	for _, sl := range composed(ls.forward[id]) {
+		for _, otherSl := range composed(ls.backward[sl.to]) {
+			if otherSl.to == id {
+				continue
+			}
+			mp[otherSl.to] += metric.Contribution(sl.ts, otherSl.ts)
+			commons[otherSl.to]++
+		}
+	}
+
+	likees := len(ls.forwardMap[id])
+	for other, sum := range mp {
+		mp[other] = metric.Normalize(sum, likees, len(ls.forwardMap[other]), commons[other])
+	}
+
+	return mp
+}
+
+// LikeContribution is a part of the similarity which comes from a likee liked by both accounts.
+// Contribution is before the normalization of the metric.
+type LikeContribution struct {
+	Likee        int
+	Contribution float64
+}
+
+// LikeSimilarityContributions breaks down the similarity between id and otherId into common likees.
+func (ls *LikeStore) LikeSimilarityContributions(id, otherId int, metric LikeSimilarityMetric) []LikeContribution {
+	var ret []LikeContribution
+	if id >= len(ls.forward) || otherId >= len(ls.forward) {
+		return ret
+	}
+
+	mine := map[int]float64{}
+	for _, sl := range composed(ls.forward[id]) {
+		mine[sl.to] = sl.ts
+	}
+	for _, otherSl := range composed(ls.forward[otherId]) {
+		if ts, ok := mine[otherSl.to]; ok {
+			ret = append(ret, LikeContribution{otherSl.to, metric.Contribution(ts, otherSl.ts)})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Contribution > ret[j].Contribution
+	})
+	return ret
+}
@@ -3,8 +3,8 @@ package store
 import (
 	"fmt"
 	"hlc2018/common"
-	"math"
 	"sort"
+	"sync"
 )
 
 type storedLike struct {
@@ -20,11 +20,23 @@ type LikeStore struct {
 	accountStore      *AccountStore
 	forward, backward [][]storedLike
 	forwardMap        []map[int]struct{}
+	// version is incremented on every inserted like
+	version        int
+	neighbourCache *likeNeighbourCache
+	// nil unless EnableLSH is called
+	lsh *likeLSH
+	// passer -> passed accounts
+	passes      []map[int]struct{}
+	degreeOrder *likeDegreeOrder
+	// guards the writes against LikeGraph, which is called out of the requests by the scheduled analytics
+	mu sync.RWMutex
 }
 
 func NewLikeStore(accountStore *AccountStore) *LikeStore {
 	return &LikeStore{
-		accountStore: accountStore,
+		accountStore:   accountStore,
+		neighbourCache: newLikeNeighbourCache(),
+		degreeOrder:    newLikeDegreeOrder(),
 	}
 }
 
@@ -33,19 +45,142 @@ func (ls *LikeStore) ExtendSizeIfNeeded(nextSize int) {
 		ls.forward = append(ls.forward, []storedLike{})
 		ls.backward = append(ls.backward, []storedLike{})
 		ls.forwardMap = append(ls.forwardMap, map[int]struct{}{})
+		ls.passes = append(ls.passes, nil)
 	}
 }
 
 func (ls *LikeStore) InsertLike(from, to, ts int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.insertLike(from, to, ts)
+}
+
+func (ls *LikeStore) insertLike(from, to, ts int) {
 	if from < to {
 		ls.ExtendSizeIfNeeded(to + 1)
 	} else {
 		ls.ExtendSizeIfNeeded(from + 1)
 	}
 
+	ls.neighbourCache.invalidateLike(from, ls.backward[to])
+	ls.degreeOrder.move(to, len(ls.backward[to]), len(ls.backward[to])+1)
 	ls.forward[from] = append(ls.forward[from], storedLike{to, ts})
 	ls.forwardMap[from][to] = struct{}{}
 	ls.backward[to] = append(ls.backward[to], storedLike{from, ts})
+	if ls.lsh != nil {
+		ls.lsh.insertLike(from, to)
+	}
+	ls.version++
+}
+
+func withoutLikesOf(sls []storedLike, id int) []storedLike {
+	ret := sls[:0]
+	for _, sl := range sls {
+		if sl.to != id {
+			ret = append(ret, sl)
+		}
+	}
+	return ret
+}
+
+// MoveLikes re-points the likes sent and received by from to into, and leaves from without likes.
+// likes between from and into are dropped. passes by and of from are moved too.
+func (ls *LikeStore) MoveLikes(from, into int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if from < into {
+		ls.ExtendSizeIfNeeded(into + 1)
+	} else {
+		ls.ExtendSizeIfNeeded(from + 1)
+	}
+	ls.neighbourCache.clear()
+
+	// copied because the lists are filtered in place
+	sent := append([]storedLike{}, ls.forward[from]...)
+	received := append([]storedLike{}, ls.backward[from]...)
+	for _, sl := range sent {
+		before := len(ls.backward[sl.to])
+		ls.backward[sl.to] = withoutLikesOf(ls.backward[sl.to], from)
+		ls.degreeOrder.move(sl.to, before, len(ls.backward[sl.to]))
+	}
+	for _, sl := range received {
+		ls.forward[sl.to] = withoutLikesOf(ls.forward[sl.to], from)
+		delete(ls.forwardMap[sl.to], from)
+	}
+	ls.degreeOrder.move(from, len(received), 0)
+	ls.forward[from] = []storedLike{}
+	ls.backward[from] = []storedLike{}
+	ls.forwardMap[from] = map[int]struct{}{}
+
+	if ls.lsh != nil {
+		ls.lsh.reset(from)
+		for _, sl := range received {
+			ls.lsh.reset(sl.to)
+			for _, remaining := range ls.forward[sl.to] {
+				ls.lsh.insertLike(sl.to, remaining.to)
+			}
+		}
+	}
+
+	for _, sl := range sent {
+		if sl.to != into && sl.to != from {
+			ls.insertLike(into, sl.to, sl.ts)
+		}
+	}
+	for _, sl := range received {
+		if sl.to != into && sl.to != from {
+			ls.insertLike(sl.to, into, sl.ts)
+		}
+	}
+
+	for passed, _ := range ls.passes[from] {
+		if passed != into {
+			ls.insertPass(into, passed)
+		}
+	}
+	ls.passes[from] = nil
+	// passes have no reverse index, so every passer is visited
+	for passer, passed := range ls.passes {
+		if _, found := passed[from]; !found {
+			continue
+		}
+		delete(passed, from)
+		if passer != into {
+			passed[into] = struct{}{}
+		}
+	}
+	ls.version++
+}
+
+// InsertPass records that from doesn't want to be suggested to. ts is not kept for now.
+func (ls *LikeStore) InsertPass(from, to, ts int) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.insertPass(from, to)
+}
+
+func (ls *LikeStore) insertPass(from, to int) {
+	if from < to {
+		ls.ExtendSizeIfNeeded(to + 1)
+	} else {
+		ls.ExtendSizeIfNeeded(from + 1)
+	}
+	if ls.passes[from] == nil {
+		ls.passes[from] = map[int]struct{}{}
+	}
+	ls.passes[from][to] = struct{}{}
+}
+
+func (ls *LikeStore) IsPassed(from, to int) bool {
+	if from >= len(ls.passes) {
+		return false
+	}
+	_, found := ls.passes[from][to]
+	return found
+}
+
+func (ls *LikeStore) Version() int {
+	return ls.version
 }
 
 func (ls *LikeStore) InsertCommonLikeWithoutRangeCheck(like *common.Like) error {
@@ -54,8 +189,12 @@ func (ls *LikeStore) InsertCommonLikeWithoutRangeCheck(like *common.Like) error
 }
 
 func (ls *LikeStore) IsValidCommonLike(like *common.Like) error {
-	if like.AccountIdTo >= len(ls.accountStore.accounts) || like.AccountIdFrom >= len(ls.accountStore.accounts) {
-		return fmt.Errorf("liker or likee id are not found")
+	// merged accounts are left as gaps
+	if _, err := ls.accountStore.GetStoredAccount(like.AccountIdFrom); err != nil {
+		return fmt.Errorf("liker (%d) is not found", like.AccountIdFrom)
+	}
+	if _, err := ls.accountStore.GetStoredAccount(like.AccountIdTo); err != nil {
+		return fmt.Errorf("likee (%d) is not found", like.AccountIdTo)
 	}
 	return nil
 }
@@ -68,7 +207,26 @@ func (ls *LikeStore) InsertCommonLike(like *common.Like) error {
 	return nil
 }
 
+// LikeesCount returns the number of likes sent by id.
+func (ls *LikeStore) LikeesCount(id int) int {
+	if id >= len(ls.forward) {
+		return 0
+	}
+	return len(ls.forward[id])
+}
+
+// LikersCount returns the number of likes received by id.
+func (ls *LikeStore) LikersCount(id int) int {
+	if id >= len(ls.backward) {
+		return 0
+	}
+	return len(ls.backward[id])
+}
+
 func (ls *LikeStore) CheckContainAllLikes(id int, liked []int) bool {
+	if id >= len(ls.forwardMap) {
+		return len(liked) == 0
+	}
 	for _, l := range liked {
 		if _, ok := ls.forwardMap[id][l]; !ok {
 			return false
@@ -143,23 +301,17 @@ func composed(mp []storedLike) []storedLikeFloat64 {
 	return ret2
 }
 
-func (ls *LikeStore) OrderByLikeSimilarity(id int) []int {
-	mp := map[int]float64{}
+// LikeSimilarities returns the similarity of id with every other liker of id's likees by the HLC metric.
+func (ls *LikeStore) LikeSimilarities(id int) map[int]float64 {
+	return ls.LikeSimilaritiesWithMetric(id, LikeSimilarityMetrics[DefaultLikeSimilarityMetric])
+}
 
-	for _, sl := range composed(ls.forward[id]) {
-		for _, otherSl := range composed(ls.backward[sl.to]) {
-			if otherSl.to == id {
-				continue
-			}
-			div := float64(sl.ts - otherSl.ts)
-			if div == 0 {
-				div = 1
-			}
-			add := 1 / math.Abs(div)
-			mp[otherSl.to] += add
-		}
-	}
+func (ls *LikeStore) OrderByLikeSimilarity(id int) []int {
+	return OrderBySimilarity(ls.LikeSimilarities(id))
+}
 
+// OrderBySimilarity returns ids in mp in the descending order of their similarities.
+func OrderBySimilarity(mp map[int]float64) []int {
 	type P struct {
 		id  int
 		val float64
@@ -181,12 +333,74 @@ func (ls *LikeStore) OrderByLikeSimilarity(id int) []int {
 	return ret
 }
 
-func (ls *LikeStore) GetNotLiked(id, othersId int, mp *map[int]struct{}, ret *[]int, limit int) {
+// MostLiked returns up to limit accounts passing filter in descending order of the number of likes received.
+// accounts without received likes are not returned.
+func (ls *LikeStore) MostLiked(filter func(id int) bool, limit int) []int {
+	var ret []int
+	ls.WalkByLikersCount(func(id, count int) bool {
+		if filter(id) {
+			ret = append(ret, id)
+		}
+		return len(ret) < limit
+	})
+	return ret
+}
+
+// LikeGraph returns a copy of the distinct likees of every account for computations outside of requests,
+// and whether each id is a stored account. likes are blocked only while they are copied.
+func (ls *LikeStore) LikeGraph() ([][]int, []bool) {
+	ls.mu.RLock()
+	graph := make([][]int, len(ls.forwardMap))
+	for from, mp := range ls.forwardMap {
+		graph[from] = make([]int, 0, len(mp))
+		for to, _ := range mp {
+			graph[from] = append(graph[from], to)
+		}
+	}
+	ls.mu.RUnlock()
+
+	for _, tos := range graph {
+		sort.Ints(tos)
+	}
+	// accounts inserted after the likes are copied have no likes in graph
+	exists := ls.accountStore.Exists()
+	if len(exists) > len(graph) {
+		exists = exists[:len(graph)]
+	}
+	for len(exists) < len(graph) {
+		exists = append(exists, false)
+	}
+	return graph, exists
+}
+
+// Likers returns the accounts which like id without duplication.
+func (ls *LikeStore) Likers(id int) []int {
+	var ret []int
+	if id >= len(ls.backward) {
+		return ret
+	}
+	seen := map[int]struct{}{}
+	for _, sl := range ls.backward[id] {
+		if _, found := seen[sl.to]; found {
+			continue
+		}
+		seen[sl.to] = struct{}{}
+		ret = append(ret, sl.to)
+	}
+	return ret
+}
+
+// GetNotLiked appends the accounts liked by othersId but not by id to ret. excluded is checked once per
+// liked account and should answer in constant time.
+func (ls *LikeStore) GetNotLiked(id, othersId int, mp *map[int]struct{}, ret *[]int, limit int, excluded func(id, other int) bool) {
 	var vp []int
 	for _, sl := range ls.forward[othersId] {
 		if _, alreadyLiked := ls.forwardMap[id][sl.to]; alreadyLiked {
 			continue
 		}
+		if excluded(id, sl.to) {
+			continue
+		}
 		vp = append(vp, sl.to)
 	}
 
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxPhoneCountryDigits = 3
+	maxPhoneCodeDigits    = 5
+	minPhoneNumberDigits  = 4
+	maxPhoneNumberDigits  = 12
+)
+
+// CompressedPhone is a phone number like "8(912)3456789" or "+44(20)12345678" in 16 bytes.
+// the lengths of the code and the number are kept to restore their leading zeros.
+// the zero value is no phone.
+type CompressedPhone struct {
+	Number uint64
+	// country (10 bits), plus sign (1 bit), code (17 bits) and the length of code (3 bits) from the top
+	prefix    uint32
+	numberLen uint8
+}
+
+func parsePhoneDigits(s, name string, minLen, maxLen int) (uint64, error) {
+	if len(s) < minLen || len(s) > maxLen {
+		return 0, fmt.Errorf("%s of phone should have %d - %d digits (%s)", name, minLen, maxLen, s)
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("%s of phone should be [0-9] (%s)", name, s)
+		}
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// CompressedPhoneFromString parses "[+]<country>(<code>)<number>". spaces and hyphens in the number are ignored.
+func CompressedPhoneFromString(phone string) (CompressedPhone, error) {
+	if phone == "" {
+		return CompressedPhone{}, nil
+	}
+	open := strings.IndexByte(phone, '(')
+	close := strings.IndexByte(phone, ')')
+	if open == -1 || close < open {
+		return CompressedPhone{}, fmt.Errorf("phone should be like 8(912)3456789 (%s)", phone)
+	}
+
+	plus := strings.HasPrefix(phone, "+")
+	countryStr := phone[:open]
+	if plus {
+		countryStr = countryStr[1:]
+	}
+	country, err := parsePhoneDigits(countryStr, "country", 1, maxPhoneCountryDigits)
+	if err != nil {
+		return CompressedPhone{}, err
+	}
+	codeStr := phone[open+1 : close]
+	code, err := parsePhoneDigits(codeStr, "code", 1, maxPhoneCodeDigits)
+	if err != nil {
+		return CompressedPhone{}, err
+	}
+	numberStr := strings.NewReplacer(" ", "", "-", "").Replace(phone[close+1:])
+	number, err := parsePhoneDigits(numberStr, "number", minPhoneNumberDigits, maxPhoneNumberDigits)
+	if err != nil {
+		return CompressedPhone{}, err
+	}
+
+	prefix := uint32(country)<<21 | uint32(code)<<3 | uint32(len(codeStr))
+	if plus {
+		prefix |= 1 << 20
+	}
+	return CompressedPhone{number, prefix, uint8(len(numberStr))}, nil
+}
+
+func (cp CompressedPhone) IsEmpty() bool {
+	return cp.numberLen == 0
+}
+
+func (cp CompressedPhone) Country() int {
+	return int(cp.prefix >> 21)
+}
+
+func (cp CompressedPhone) hasPlus() bool {
+	return cp.prefix&(1<<20) != 0
+}
+
+// CodeString returns the code in the parentheses with its leading zeros, or "" when the phone is empty.
+func (cp CompressedPhone) CodeString() string {
+	if cp.IsEmpty() {
+		return ""
+	}
+	return fmt.Sprintf("%0*d", cp.codeLen(), cp.code())
+}
+
+func (cp CompressedPhone) String() string {
+	if cp.IsEmpty() {
+		return ""
+	}
+	plus := ""
+	if cp.hasPlus() {
+		plus = "+"
+	}
+	return fmt.Sprintf("%s%d(%s)%0*d", plus, cp.Country(), cp.CodeString(), cp.numberLen, cp.Number)
+}
+
+func (cp CompressedPhone) code() uint32 {
+	return cp.prefix >> 3 & (1<<17 - 1)
+}
+
+func (cp CompressedPhone) codeLen() uint8 {
+	return uint8(cp.prefix & 7)
+}
+
+// PhoneCode is a code in the parentheses of phones. the length keeps its leading zeros.
+// the zero value is no code.
+type PhoneCode struct {
+	code   uint32
+	length uint8
+}
+
+func PhoneCodeFromString(s string) (PhoneCode, error) {
+	code, err := parsePhoneDigits(s, "code", 1, maxPhoneCodeDigits)
+	if err != nil {
+		return PhoneCode{}, err
+	}
+	return PhoneCode{uint32(code), uint8(len(s))}, nil
+}
+
+func (pc PhoneCode) IsEmpty() bool {
+	return pc.length == 0
+}
+
+func (cp CompressedPhone) HasPhoneCode(pc PhoneCode) bool {
+	if cp.IsEmpty() {
+		return false
+	}
+	return cp.code() == pc.code && cp.codeLen() == pc.length
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"container/heap"
+	"hlc2018/common"
+	"math"
+	"sync"
+	"sync/atomic"
+)
+
+type premiumEvent struct {
+	ts, id int
+	// position in the heap
+	index int
+}
+
+type premiumEventHeap []*premiumEvent
+
+func (h premiumEventHeap) Len() int           { return len(h) }
+func (h premiumEventHeap) Less(i, j int) bool { return h[i].ts < h[j].ts }
+func (h premiumEventHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+func (h *premiumEventHeap) Push(x interface{}) {
+	e := x.(*premiumEvent)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *premiumEventHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// PremiumScheduler keeps the next time when the premium period of each account starts or expires,
+// and flips Premium_now at it. an account has at most one event, which is replaced when the period is changed.
+type PremiumScheduler struct {
+	accountStore *AccountStore
+	mu           sync.Mutex
+	events       premiumEventHeap
+	eventOf      map[int]*premiumEvent
+	// the time of the first event, read without mu
+	next int64
+}
+
+func NewPremiumScheduler(accountStore *AccountStore) *PremiumScheduler {
+	return &PremiumScheduler{accountStore: accountStore, eventOf: map[int]*premiumEvent{}, next: math.MaxInt64}
+}
+
+func (ps *PremiumScheduler) updateNext() {
+	next := int64(math.MaxInt64)
+	if len(ps.events) > 0 {
+		next = int64(ps.events[0].ts)
+	}
+	atomic.StoreInt64(&ps.next, next)
+}
+
+// Due returns true if any event is due at now.
+func (ps *PremiumScheduler) Due(now int) bool {
+	return atomic.LoadInt64(&ps.next) <= int64(now)
+}
+
+// nextPremiumEvent returns the first time after now when premium_now of a changes, or 0 if it doesn't change.
+func nextPremiumEvent(a *StoredAccount, now int) int {
+	if a == nil || a.Premium_start == 0 {
+		return 0
+	}
+	if a.Premium_start > now {
+		return a.Premium_start
+	}
+	// premium is valid until Premium_end inclusive
+	if a.Premium_end >= now {
+		return a.Premium_end + 1
+	}
+	return 0
+}
+
+func (ps *PremiumScheduler) schedule(id, now int) {
+	ts := nextPremiumEvent(ps.accountStore.GetStoredAccountWithoutError(id), now)
+	e, found := ps.eventOf[id]
+	switch {
+	case ts == 0 && found:
+		heap.Remove(&ps.events, e.index)
+		delete(ps.eventOf, id)
+	case ts != 0 && found:
+		e.ts = ts
+		heap.Fix(&ps.events, e.index)
+	case ts != 0:
+		e = &premiumEvent{ts: ts, id: id}
+		heap.Push(&ps.events, e)
+		ps.eventOf[id] = e
+	}
+}
+
+// Schedule replaces the event of id by the next start or expiry of its premium period after now.
+func (ps *PremiumScheduler) Schedule(id, now int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.schedule(id, now)
+	ps.updateNext()
+}
+
+// ScheduleAll registers every account. it is called once after loading.
+func (ps *PremiumScheduler) ScheduleAll(now int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for id := range ps.accountStore.accounts {
+		ps.schedule(id, now)
+	}
+	ps.updateNext()
+}
+
+// Tick flips Premium_now of accounts whose events are due at now and calls changed with their ids.
+// changed is called under the lock, so the reindexing by concurrent ticks is serialized.
+func (ps *PremiumScheduler) Tick(now int, changed func(id int)) {
+	if !ps.Due(now) {
+		return
+	}
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	defer ps.updateNext()
+	for len(ps.events) > 0 && ps.events[0].ts <= now {
+		e := heap.Pop(&ps.events).(*premiumEvent)
+		delete(ps.eventOf, e.id)
+		a := ps.accountStore.GetStoredAccountWithoutError(e.id)
+		// deleted after it is scheduled
+		if a == nil {
+			continue
+		}
+		premiumNow := common.IsPremiumNow(a.Premium_start, a.Premium_end, now)
+		if a.Premium_now != premiumNow {
+			a.Premium_now = premiumNow
+			changed(e.id)
+		}
+		// the expiry after the start
+		ps.schedule(e.id, now)
+	}
+}
@@ -0,0 +1,123 @@
+package store
+
+import "hlc2018/common"
+
+type recommendBucketKey struct {
+	sex         int8
+	premiumNow  bool
+	statusOrder int
+	interest    int
+	// 0 unless the bucket is partitioned by country
+	country int
+}
+
+// RecommendIndex partitions accounts by (sex, premium_now, status, interest) and optionally by country,
+// so that recommend can visit candidates in the order of premium_now and status and stop early.
+type RecommendIndex struct {
+	accountStore  *AccountStore
+	interestStore *InterestStore
+	byCountry     bool
+	buckets       map[recommendBucketKey]map[int]struct{}
+	// keys of the buckets each account is in
+	keysOfAccount [][]recommendBucketKey
+	built         bool
+}
+
+func NewRecommendIndex(accountStore *AccountStore, interestStore *InterestStore, byCountry bool) *RecommendIndex {
+	return &RecommendIndex{
+		accountStore:  accountStore,
+		interestStore: interestStore,
+		byCountry:     byCountry,
+		buckets:       map[recommendBucketKey]map[int]struct{}{},
+	}
+}
+
+func (ri *RecommendIndex) ExtendSizeIfNeeded(nextSize int) {
+	for len(ri.keysOfAccount) < nextSize {
+		ri.keysOfAccount = append(ri.keysOfAccount, nil)
+	}
+}
+
+func (ri *RecommendIndex) remove(id int) {
+	for _, key := range ri.keysOfAccount[id] {
+		delete(ri.buckets[key], id)
+		if len(ri.buckets[key]) == 0 {
+			delete(ri.buckets, key)
+		}
+	}
+	ri.keysOfAccount[id] = nil
+}
+
+func (ri *RecommendIndex) add(key recommendBucketKey, id int) {
+	if ri.buckets[key] == nil {
+		ri.buckets[key] = map[int]struct{}{}
+	}
+	ri.buckets[key][id] = struct{}{}
+	ri.keysOfAccount[id] = append(ri.keysOfAccount[id], key)
+}
+
+// Reindex puts id into the buckets of its current sex, premium_now, status, interests and country.
+// it must be called after the account or its interests are inserted or updated.
+func (ri *RecommendIndex) Reindex(id int) {
+	if !ri.built {
+		return
+	}
+	ri.ExtendSizeIfNeeded(id + 1)
+	ri.remove(id)
+
+	a := ri.accountStore.GetStoredAccountWithoutError(id)
+	if a == nil || id >= len(ri.interestStore.pkToStringId) {
+		return
+	}
+	for interestId, _ := range ri.interestStore.pkToStringId[id] {
+		key := recommendBucketKey{a.Sex, a.Premium_now, common.StatusRecommendOrder(a.Status), interestId, 0}
+		ri.add(key, id)
+		if ri.byCountry && a.Country != 0 {
+			key.country = a.Country
+			ri.add(key, id)
+		}
+	}
+}
+
+// Build indexes every account. Reindex does nothing before Build.
+func (ri *RecommendIndex) Build() {
+	ri.built = true
+	for id := 0; id < len(ri.accountStore.accounts); id++ {
+		ri.Reindex(id)
+	}
+}
+
+func (ri *RecommendIndex) Built() bool {
+	return ri.built
+}
+
+// Walk visits the accounts sharing interests with me by tiers of (premium_now, status) in the order of recommend.
+// visit receives the numbers of common interests in a tier and returns false to stop.
+// country is used only when the index is partitioned by country, and 0 means any country.
+func (ri *RecommendIndex) Walk(me *StoredAccount, sexes []int8, country int, visit func(counts map[int]int) bool) {
+	if me.ID >= len(ri.interestStore.pkToStringId) {
+		return
+	}
+	if !ri.byCountry {
+		country = 0
+	}
+
+	for _, premiumNow := range []bool{true, false} {
+		for statusOrder := 0; statusOrder < 3; statusOrder++ {
+			counts := map[int]int{}
+			for _, sex := range sexes {
+				for interestId, _ := range ri.interestStore.pkToStringId[me.ID] {
+					key := recommendBucketKey{sex, premiumNow, statusOrder, interestId, country}
+					for id, _ := range ri.buckets[key] {
+						if id != me.ID {
+							counts[id]++
+						}
+					}
+				}
+			}
+			if len(counts) > 0 && !visit(counts) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package tester
+
+import (
+	"hlc2018/globals"
+	"hlc2018/store"
+	"log"
+	"os"
+	"strconv"
+)
+
+const defaultLSHRecallK = 10
+
+// MeasureLSHRecall returns the average ratio of the exact top k similar likers which are found by LSH.
+// accounts without similar likers are skipped.
+func MeasureLSHRecall(ids []int, k int, metric store.LikeSimilarityMetric) float64 {
+	sum := 0.0
+	measured := 0
+	for _, id := range ids {
+		exact := store.OrderBySimilarity(globals.Ls.LikeSimilaritiesWithMetric(id, metric))
+		if len(exact) == 0 {
+			continue
+		}
+		if len(exact) > k {
+			exact = exact[:k]
+		}
+		approx := store.OrderBySimilarity(globals.Ls.ApproximateLikeSimilarities(id, metric))
+		if len(approx) > k {
+			approx = approx[:k]
+		}
+
+		found := map[int]struct{}{}
+		for _, a := range approx {
+			found[a] = struct{}{}
+		}
+		hit := 0
+		for _, e := range exact {
+			if _, ok := found[e]; ok {
+				hit++
+			}
+		}
+		sum += float64(hit) / float64(len(exact))
+		measured++
+	}
+	if measured == 0 {
+		return 0
+	}
+	return sum / float64(measured)
+}
+
+// RunLSHRecall logs the recall of LSH for the first n accounts by every metric.
+func RunLSHRecall(n, k int) {
+	if !globals.Ls.LSHEnabled() {
+		log.Print("LSH is not enabled")
+		return
+	}
+	var ids []int
+	for id := 1; id <= n; id++ {
+		ids = append(ids, id)
+	}
+	for name, metric := range store.LikeSimilarityMetrics {
+		log.Printf("LSH recall@%d (%s) = %f", k, name, MeasureLSHRecall(ids, k, metric))
+	}
+}
+
+// runLSHRecallIfRequested measures the recall for the first LSH_RECALL accounts when it is given.
+// k is LSH_RECALL_K, or 10 by default.
+func runLSHRecallIfRequested() {
+	accounts := os.Getenv("LSH_RECALL")
+	if accounts == "" {
+		return
+	}
+	n, err := strconv.Atoi(accounts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	k := defaultLSHRecallK
+	if env := os.Getenv("LSH_RECALL_K"); env != "" {
+		if k, err = strconv.Atoi(env); err != nil {
+			log.Fatal(err)
+		}
+	}
+	RunLSHRecall(n, k)
+}
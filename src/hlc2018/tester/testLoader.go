@@ -216,4 +216,5 @@ func RunTest() {
 	RunTestCases(testCases1)
 	RunTestCases(testCases2)
 	RunTestCases(testCases3)
+	runLSHRecallIfRequested()
 }